@@ -0,0 +1,434 @@
+package bigiq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// ActivationStatus is the state of a registration key activation, both for
+// BIG-IQ initial activations and for the offerings of a regkey pool.
+type ActivationStatus string
+
+const (
+	// Requested states, used to start or retry an activation.
+	ActivationAutomatic ActivationStatus = "ACTIVATING_AUTOMATIC"
+	ActivationManual    ActivationStatus = "ACTIVATING_MANUAL"
+
+	ActivationInProgress         ActivationStatus = "LICENSING_ACTIVATION_IN_PROGRESS"
+	ActivationNeedEULA           ActivationStatus = "NEED_EULA_ACCEPT"
+	ActivationAutomaticNeedEULA  ActivationStatus = "ACTIVATING_AUTOMATIC_NEED_EULA_ACCEPT"
+	ActivationEULAAccepted       ActivationStatus = "ACTIVATING_AUTOMATIC_EULA_ACCEPTED"
+	ActivationNeedLicenseText    ActivationStatus = "ACTIVATING_MANUAL_NEED_LICENSE_TEXT"
+	ActivationLicenseTextEntered ActivationStatus = "ACTIVATING_MANUAL_LICENSE_TEXT_PROVIDED"
+	ActivationComplete           ActivationStatus = "LICENSING_COMPLETE"
+	ActivationFailed             ActivationStatus = "LICENSING_FAILED"
+
+	// Final states of the offerings of a regkey pool.
+	OfferingReady            ActivationStatus = "READY"
+	OfferingActivationFailed ActivationStatus = "ACTIVATION_FAILED"
+)
+
+// NeedsEULA reports whether the activation is waiting for the EULA to be
+// accepted.
+func (s ActivationStatus) NeedsEULA() bool {
+	return s == ActivationNeedEULA || s == ActivationAutomaticNeedEULA
+}
+
+// NeedsLicenseText reports whether a manual activation is waiting for the
+// license text from the F5 activation portal.
+func (s ActivationStatus) NeedsLicenseText() bool {
+	return s == ActivationNeedLicenseText
+}
+
+// Done reports whether the activation has finished, successfully or not.
+func (s ActivationStatus) Done() bool {
+	return s.Succeeded() || s.Failed()
+}
+
+// Succeeded reports whether the activation has finished successfully.
+func (s ActivationStatus) Succeeded() bool {
+	return s == ActivationComplete || s == OfferingReady
+}
+
+// Failed reports whether the activation has failed.
+func (s ActivationStatus) Failed() bool {
+	return s == ActivationFailed || s == OfferingActivationFailed
+}
+
+// waiting reports whether the activation is blocked on the caller.
+func (s ActivationStatus) waiting() bool {
+	return s.NeedsEULA() || s.NeedsLicenseText()
+}
+
+// Activation is the state of a registration key activation.
+type Activation struct {
+	RegKey      string           `json:"regKey"`
+	Name        string           `json:"name,omitempty"`
+	Description string           `json:"description,omitempty"`
+	Status      ActivationStatus `json:"status"`
+	Message     string           `json:"message,omitempty"`
+	EulaText    string           `json:"eulaText,omitempty"`
+	Dossier     string           `json:"dossier,omitempty"`
+	LicenseText string           `json:"licenseText,omitempty"`
+	Generation  int              `json:"generation,omitempty"`
+	SelfLink    string           `json:"selfLink,omitempty"`
+}
+
+// ActivationError is returned when an activation fails or stops in a state
+// the automatic flow cannot resolve.
+type ActivationError struct {
+	RegKey  string
+	Status  ActivationStatus
+	Message string
+}
+
+func (e *ActivationError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("activation of REG-KEY %s ended in %s", e.RegKey, e.Status)
+	}
+	return fmt.Sprintf("activation of REG-KEY %s ended in %s: %s", e.RegKey, e.Status, e.Message)
+}
+
+// ActivationOptions controls ActivateRegKey.
+type ActivationOptions struct {
+	RegKey string
+	Name   string
+	// PollInterval is the delay between status polls. Defaults to 5 seconds.
+	PollInterval time.Duration
+	// MaxRetries is the number of times a failed activation is
+	// retried before giving up.
+	MaxRetries int
+	// CleanupOnFailure removes the activation entry when the activation
+	// ultimately fails, so that the key can be activated again from scratch.
+	CleanupOnFailure bool
+}
+
+// activationPollInterval is the default delay between activation status polls.
+var activationPollInterval = 5 * time.Second
+
+func initialActivationPath(regkey string) []string {
+	return []string{uriMgmt, uriCm, uriDevice, uriLicensing, uriPool, uriInitActivation, regkey}
+}
+
+// InitialActivation starts the activation of a BIG-IQ registration key with
+// status ActivationAutomatic or ActivationManual.
+func (b *BigIQ) InitialActivation(regkey, name string, status ActivationStatus) (*Activation, error) {
+	license := LicenseDetails{
+		RegKey: regkey,
+		Name:   name,
+		Status: status,
+	}
+	licResp, err := b.postReq(license, uriMgmt, uriCm, uriDevice, uriLicensing, uriPool, uriInitActivation)
+	if err != nil {
+		return nil, err
+	}
+	var activation Activation
+	if err := json.Unmarshal(licResp, &activation); err != nil {
+		return nil, err
+	}
+	return &activation, nil
+}
+
+// GetActivation returns the current state of the initial activation of regkey.
+func (b *BigIQ) GetActivation(regkey string) (*Activation, error) {
+	return b.getActivationAt(regkey, initialActivationPath(regkey))
+}
+
+// PollActivation returns the current state of the initial activation of
+// regkey, accepting the EULA if the activation is waiting for it.
+func (b *BigIQ) PollActivation(regkey string) (*Activation, error) {
+	activation, err := b.GetActivation(regkey)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case activation.Status.NeedsEULA():
+		return b.AcceptEULA(regkey)
+	case activation.Status.NeedsLicenseText():
+		log.Printf("[INFO] %v for REG-KEY: %s", activation.Status, regkey)
+	}
+	return activation, nil
+}
+
+// WaitForActivation polls the initial activation of regkey every interval
+// until it is complete, has failed or is waiting on the caller (EULA or
+// license text), and returns its state.
+func (b *BigIQ) WaitForActivation(ctx context.Context, regkey string, interval time.Duration) (*Activation, error) {
+	return b.waitForActivationAt(ctx, regkey, interval, initialActivationPath(regkey))
+}
+
+// GetDossier returns the dossier of a manual activation. The dossier is only
+// available once the activation has reached ACTIVATING_MANUAL_NEED_LICENSE_TEXT;
+// see WaitForDossier.
+func (b *BigIQ) GetDossier(regkey string) (string, error) {
+	activation, err := b.GetActivation(regkey)
+	if err != nil {
+		return "", err
+	}
+	if activation.Dossier == "" {
+		return "", fmt.Errorf("dossier not available for REG-KEY: %s (status %s)", regkey, activation.Status)
+	}
+	return activation.Dossier, nil
+}
+
+// AcceptEULA accepts the EULA presented by the initial activation of regkey.
+func (b *BigIQ) AcceptEULA(regkey string) (*Activation, error) {
+	return b.acceptEULAAt(regkey, initialActivationPath(regkey))
+}
+
+// RetryActivation restarts a failed automatic activation of regkey.
+func (b *BigIQ) RetryActivation(regkey string) (*Activation, error) {
+	return b.patchActivationAt(regkey, LicenseDetails{RegKey: regkey, Status: ActivationAutomatic}, initialActivationPath(regkey))
+}
+
+// RemoveActivation deletes the initial activation entry of regkey and
+// returns its last state.
+func (b *BigIQ) RemoveActivation(regkey string) (*Activation, error) {
+	licResp, err := b.deleteReq(initialActivationPath(regkey)...)
+	if err != nil {
+		return nil, err
+	}
+	var activation Activation
+	if err := json.Unmarshal(licResp, &activation); err != nil {
+		return nil, err
+	}
+	return &activation, nil
+}
+
+// ActivateRegKey drives an automatic initial activation to completion: it
+// starts the activation, polls it, accepts the EULA, retries up to
+// opts.MaxRetries times after LICENSING_FAILED and, if opts.CleanupOnFailure
+// is set, removes the activation entry when it gives up.
+func (b *BigIQ) ActivateRegKey(ctx context.Context, opts ActivationOptions) (*Activation, error) {
+	_, err := b.InitialActivation(opts.RegKey, opts.Name, ActivationAutomatic)
+	if err != nil {
+		return nil, err
+	}
+	return b.driveActivation(ctx, opts, initialActivationPath(opts.RegKey), func() (*Activation, error) {
+		return b.RetryActivation(opts.RegKey)
+	}, func() error {
+		_, err := b.RemoveActivation(opts.RegKey)
+		return err
+	})
+}
+
+// driveActivation runs the automatic activation state machine against the
+// activation entry at path. retry restarts a failed activation and cleanup
+// removes the entry.
+func (b *BigIQ) driveActivation(ctx context.Context, opts ActivationOptions, path []string, retry func() (*Activation, error), cleanup func() error) (*Activation, error) {
+	fail := func(activation *Activation, err error) (*Activation, error) {
+		if opts.CleanupOnFailure {
+			if cerr := cleanup(); cerr != nil {
+				log.Printf("[WARN] cleanup of REG-KEY %s failed: %v", opts.RegKey, cerr)
+			}
+		}
+		return activation, err
+	}
+	retries := 0
+	eulaAccepted := false
+	for {
+		until := func(s ActivationStatus) bool { return s.Done() || s.waiting() }
+		if eulaAccepted {
+			// The status lags behind the accepted EULA; accept it only once.
+			until = func(s ActivationStatus) bool { return s.Done() || s.NeedsLicenseText() }
+		}
+		activation, err := b.pollActivationAt(ctx, opts.RegKey, opts.PollInterval, path, until)
+		if err != nil {
+			return fail(activation, err)
+		}
+		switch {
+		case activation.Status.Succeeded():
+			return activation, nil
+		case activation.Status.NeedsEULA():
+			if _, err := b.acceptEULAAt(opts.RegKey, path); err != nil {
+				return fail(activation, err)
+			}
+			eulaAccepted = true
+		case activation.Status.Failed() && retries < opts.MaxRetries:
+			retries++
+			b.metrics().IncRetry(TaskLicense)
+			log.Printf("[INFO] retrying activation of REG-KEY %s (%d/%d): %s", opts.RegKey, retries, opts.MaxRetries, activation.Message)
+			if _, err := retry(); err != nil {
+				return fail(activation, err)
+			}
+			eulaAccepted = false
+		default:
+			return fail(activation, &ActivationError{RegKey: opts.RegKey, Status: activation.Status, Message: activation.Message})
+		}
+	}
+}
+
+func (b *BigIQ) getActivationAt(regkey string, path []string) (*Activation, error) {
+	var activation Activation
+	err, ok := b.getForEntity(&activation, path...)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("no activation found for REG-KEY: %s", regkey)
+	}
+	return &activation, nil
+}
+
+// waitForActivationAt polls the activation at path until it has finished or is
+// blocked on the caller.
+func (b *BigIQ) waitForActivationAt(ctx context.Context, regkey string, interval time.Duration, path []string) (*Activation, error) {
+	return b.pollActivationAt(ctx, regkey, interval, path, func(s ActivationStatus) bool {
+		return s.Done() || s.waiting()
+	})
+}
+
+// pollActivationAt polls the activation at path until until reports its status
+// as final.
+func (b *BigIQ) pollActivationAt(ctx context.Context, regkey string, interval time.Duration, path []string, until func(ActivationStatus) bool) (*Activation, error) {
+	if interval <= 0 {
+		interval = activationPollInterval
+	}
+	var activation *Activation
+	err := b.pollTask(ctx, TaskLicense, interval, func() (bool, error) {
+		var err error
+		activation, err = b.getActivationAt(regkey, path)
+		if err != nil {
+			return false, err
+		}
+		return until(activation.Status), nil
+	})
+	return activation, err
+}
+
+func (b *BigIQ) acceptEULAAt(regkey string, path []string) (*Activation, error) {
+	activation, err := b.getActivationAt(regkey, path)
+	if err != nil {
+		return nil, err
+	}
+	if activation.EulaText == "" {
+		return activation, fmt.Errorf("no EULA to accept for REG-KEY: %s (status %s)", regkey, activation.Status)
+	}
+	patchRef := LicenseEula{
+		Status: ActivationEULAAccepted,
+		Eula:   activation.EulaText,
+	}
+	return b.patchActivationAt(regkey, patchRef, path)
+}
+
+func (b *BigIQ) patchActivationAt(regkey string, body interface{}, path []string) (*Activation, error) {
+	resp, err := b.fastPatch(body, path...)
+	if err != nil {
+		return nil, err
+	}
+	var activation Activation
+	if err := json.Unmarshal(resp, &activation); err != nil {
+		return nil, err
+	}
+	return &activation, nil
+}
+
+// manualLicenseText is the PATCH body that completes a manual activation.
+type manualLicenseText struct {
+	Status      ActivationStatus `json:"status"`
+	LicenseText string           `json:"licenseText"`
+}
+
+// StartManualActivation starts an offline (manual) activation of regkey for
+// systems without access to the F5 license server. Once the activation has
+// produced a dossier (WaitForDossier), submit it at the F5 activation portal
+// and pass the license text returned there to CompleteManualActivation.
+func (b *BigIQ) StartManualActivation(regkey, name string) (*Activation, error) {
+	return b.InitialActivation(regkey, name, ActivationManual)
+}
+
+// WaitForDossier waits for a manual activation to produce its dossier and
+// returns it. It gives up when ctx is done.
+func (b *BigIQ) WaitForDossier(ctx context.Context, regkey string) (string, error) {
+	return b.waitForDossierAt(ctx, regkey, initialActivationPath(regkey))
+}
+
+func (b *BigIQ) waitForDossierAt(ctx context.Context, regkey string, path []string) (string, error) {
+	activation, err := b.waitForActivationAt(ctx, regkey, activationPollInterval, path)
+	if err != nil {
+		return "", err
+	}
+	if activation.Dossier == "" {
+		return "", &ActivationError{RegKey: regkey, Status: activation.Status, Message: activation.Message}
+	}
+	return activation.Dossier, nil
+}
+
+// WriteDossier waits for the dossier of a manual activation and writes it to w.
+func (b *BigIQ) WriteDossier(ctx context.Context, regkey string, w io.Writer) error {
+	dossier, err := b.WaitForDossier(ctx, regkey)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, dossier)
+	return err
+}
+
+// SaveDossier waits for the dossier of a manual activation and writes it to
+// the file at path. The file is not created if there is no dossier.
+func (b *BigIQ) SaveDossier(ctx context.Context, regkey, path string) error {
+	dossier, err := b.WaitForDossier(ctx, regkey)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, []byte(dossier), 0666)
+}
+
+// CompleteManualActivation provides the license text obtained from the F5
+// activation portal for a manual activation and waits until the license is
+// installed (LICENSING_COMPLETE). It gives up when ctx is done.
+func (b *BigIQ) CompleteManualActivation(ctx context.Context, regkey, licenseText string) error {
+	return b.completeManualActivationAt(ctx, regkey, licenseText, initialActivationPath(regkey))
+}
+
+func (b *BigIQ) completeManualActivationAt(ctx context.Context, regkey, licenseText string, path []string) error {
+	licenseText = strings.TrimSpace(licenseText)
+	if licenseText == "" {
+		return fmt.Errorf("license text for REG-KEY %s is empty", regkey)
+	}
+	patchRef := manualLicenseText{
+		Status:      ActivationLicenseTextEntered,
+		LicenseText: licenseText,
+	}
+	if err := b.patch(patchRef, path...); err != nil {
+		return err
+	}
+	// BIG-IQ may still report that it needs the license text right after the
+	// PATCH, so wait for the activation to finish rather than for it to block.
+	activation, err := b.pollActivationAt(ctx, regkey, activationPollInterval, path, ActivationStatus.Done)
+	if err != nil {
+		return err
+	}
+	if !activation.Status.Succeeded() {
+		return &ActivationError{RegKey: regkey, Status: activation.Status, Message: activation.Message}
+	}
+	return nil
+}
+
+// CompleteManualActivationFromReader reads the license text from r and
+// completes the manual activation with it.
+func (b *BigIQ) CompleteManualActivationFromReader(ctx context.Context, regkey string, r io.Reader) error {
+	licenseText, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return b.CompleteManualActivation(ctx, regkey, string(licenseText))
+}
+
+// CompleteManualActivationFromFile reads the license text from the file at
+// path and completes the manual activation with it.
+func (b *BigIQ) CompleteManualActivationFromFile(ctx context.Context, regkey, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return b.CompleteManualActivationFromReader(ctx, regkey, f)
+}
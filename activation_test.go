@@ -0,0 +1,234 @@
+package bigiq
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestActivateRegKeyAcceptsEULAAndRetries(t *testing.T) {
+	// The activation fails once, is retried, then asks for the EULA.
+	states := []ActivationStatus{ActivationInProgress, ActivationFailed, ActivationAutomaticNeedEULA, ActivationComplete}
+	var patches []ActivationStatus
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		activation := Activation{RegKey: "AAAAA-BBBBB", Status: states[0], EulaText: "eula"}
+		switch r.Method {
+		case http.MethodPost:
+			activation.Status = ActivationAutomatic
+		case http.MethodGet:
+			if len(states) > 1 {
+				states = states[1:]
+			}
+		case http.MethodPatch:
+			var body LicenseDetails
+			json.NewDecoder(r.Body).Decode(&body)
+			patches = append(patches, body.Status)
+		}
+		json.NewEncoder(w).Encode(activation)
+	}))
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+
+	activation, err := b.ActivateRegKey(context.Background(), ActivationOptions{
+		RegKey:       "AAAAA-BBBBB",
+		PollInterval: time.Millisecond,
+		MaxRetries:   1,
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, ActivationComplete, activation.Status)
+	assert.Equal(t, []ActivationStatus{ActivationAutomatic, ActivationEULAAccepted}, patches)
+}
+
+func TestActivateRegKeyAcceptsEULAOnce(t *testing.T) {
+	// The status still asks for the EULA for a while after it was accepted.
+	states := []ActivationStatus{ActivationAutomaticNeedEULA, ActivationAutomaticNeedEULA, ActivationAutomaticNeedEULA, ActivationComplete}
+	var patches []ActivationStatus
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		activation := Activation{RegKey: "AAAAA-BBBBB", Status: states[0], EulaText: "eula"}
+		switch r.Method {
+		case http.MethodGet:
+			if len(states) > 1 {
+				states = states[1:]
+			}
+		case http.MethodPatch:
+			var body LicenseDetails
+			json.NewDecoder(r.Body).Decode(&body)
+			patches = append(patches, body.Status)
+		}
+		json.NewEncoder(w).Encode(activation)
+	}))
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+
+	activation, err := b.ActivateRegKey(context.Background(), ActivationOptions{
+		RegKey:       "AAAAA-BBBBB",
+		PollInterval: time.Millisecond,
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, ActivationComplete, activation.Status)
+	assert.Equal(t, []ActivationStatus{ActivationEULAAccepted}, patches)
+}
+
+func TestActivateRegKeyCleansUpOnFailure(t *testing.T) {
+	deleted := false
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodDelete {
+			deleted = true
+		}
+		json.NewEncoder(w).Encode(Activation{RegKey: "AAAAA-BBBBB", Status: ActivationFailed, Message: "invalid key"})
+	}))
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+
+	_, err := b.ActivateRegKey(context.Background(), ActivationOptions{
+		RegKey:           "AAAAA-BBBBB",
+		PollInterval:     time.Millisecond,
+		CleanupOnFailure: true,
+	})
+
+	activationErr, ok := err.(*ActivationError)
+	assert.True(t, ok)
+	assert.Equal(t, ActivationFailed, activationErr.Status)
+	assert.Equal(t, "invalid key", activationErr.Message)
+	assert.True(t, deleted)
+}
+
+func TestSaveDossierWaitsForDossier(t *testing.T) {
+	defer func(interval time.Duration) { activationPollInterval = interval }(activationPollInterval)
+	activationPollInterval = time.Millisecond
+	states := []ActivationStatus{ActivationManual, ActivationManual, ActivationNeedLicenseText}
+	var paths []string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		paths = append(paths, r.URL.Path)
+		activation := Activation{RegKey: "AAAAA-BBBBB", Status: states[0]}
+		if activation.Status == ActivationNeedLicenseText {
+			activation.Dossier = "dossier-text"
+		}
+		if len(states) > 1 {
+			states = states[1:]
+		}
+		json.NewEncoder(w).Encode(activation)
+	}))
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+	path := filepath.Join(t.TempDir(), "dossier.txt")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err := b.SaveDossier(ctx, "AAAAA-BBBBB", path)
+
+	assert.Nil(t, err)
+	dossier, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "dossier-text", string(dossier))
+	assert.Equal(t, "/mgmt/cm/device/licensing/pool/initial-activation/AAAAA-BBBBB", paths[0])
+}
+
+func TestWaitForDossierStopsWithContext(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Activation{RegKey: "AAAAA-BBBBB", Status: ActivationManual})
+	}))
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := b.WaitForDossier(ctx, "AAAAA-BBBBB")
+
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, time.Since(start) < activationPollInterval)
+}
+
+func TestSaveDossierCreatesNoFileWithoutDossier(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Activation{RegKey: "AAAAA-BBBBB", Status: ActivationFailed})
+	}))
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+	path := filepath.Join(t.TempDir(), "dossier.txt")
+
+	err := b.SaveDossier(context.Background(), "AAAAA-BBBBB", path)
+
+	assert.NotNil(t, err)
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestCompleteManualActivationFromFile(t *testing.T) {
+	status := ActivationNeedLicenseText
+	var patch manualLicenseText
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodPatch {
+			json.NewDecoder(r.Body).Decode(&patch)
+			status = ActivationComplete
+		}
+		json.NewEncoder(w).Encode(Activation{RegKey: "AAAAA-BBBBB", Status: status})
+	}))
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+	path := filepath.Join(t.TempDir(), "license.txt")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("license-text\n"), 0600))
+
+	err := b.CompleteManualActivationFromFile(context.Background(), "AAAAA-BBBBB", path)
+
+	assert.Nil(t, err)
+	assert.Equal(t, ActivationLicenseTextEntered, patch.Status)
+	assert.Equal(t, "license-text", patch.LicenseText)
+}
+
+func TestCompleteManualActivationReportsFailure(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Activation{RegKey: "AAAAA-BBBBB", Status: ActivationFailed, Message: "bad license"})
+	}))
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+
+	err := b.CompleteManualActivation(context.Background(), "AAAAA-BBBBB", "license-text")
+
+	activationErr, ok := err.(*ActivationError)
+	assert.True(t, ok)
+	assert.Equal(t, "bad license", activationErr.Message)
+}
+
+func TestCompleteManualActivationWaitsPastLaggingStatus(t *testing.T) {
+	defer func(interval time.Duration) { activationPollInterval = interval }(activationPollInterval)
+	activationPollInterval = time.Millisecond
+	// BIG-IQ still asks for the license text twice after it was provided.
+	states := []ActivationStatus{ActivationNeedLicenseText, ActivationNeedLicenseText, ActivationLicenseTextEntered, ActivationComplete}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodPatch {
+			json.NewEncoder(w).Encode(Activation{RegKey: "AAAAA-BBBBB", Status: ActivationLicenseTextEntered})
+			return
+		}
+		json.NewEncoder(w).Encode(Activation{RegKey: "AAAAA-BBBBB", Status: states[0]})
+		if len(states) > 1 {
+			states = states[1:]
+		}
+	}))
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+
+	err := b.CompleteManualActivation(context.Background(), "AAAAA-BBBBB", "license-text")
+
+	assert.Nil(t, err)
+	assert.Equal(t, []ActivationStatus{ActivationComplete}, states)
+}
@@ -59,6 +59,24 @@ type Results1 struct {
 PostAs3BigIQ used for posting as3 json file to BigIQ
 */
 func (b *BigIQ) PostAs3BigIQ(as3NewJson string, tenantFilter string) (error, string, string) {
+	start, polls := time.Now(), 0
+	err, tenants, id := b.postAs3BigIQ(as3NewJson, tenantFilter, &polls)
+	b.observeAS3Task(polls, start)
+	b.recordTeem(TeemAS3Deploy, start, err)
+	return err, tenants, id
+}
+
+// observeAS3Task records one task observation for an AS3 operation, however
+// often it was restarted. Nothing is recorded if no task was started.
+func (b *BigIQ) observeAS3Task(polls int, start time.Time) {
+	if polls > 0 {
+		b.metrics().ObserveTaskPoll(TaskAS3, polls, time.Since(start))
+	}
+}
+
+// postAs3BigIQ deploys the declaration, starting over while another AS3 task
+// is running. polls counts the status polls of all attempts.
+func (b *BigIQ) postAs3BigIQ(as3NewJson string, tenantFilter string, polls *int) (error, string, string) {
 	tenant := tenantFilter + "?async=true"
 	successfulTenants := make([]string, 0)
 	resp, err := b.postReq(as3NewJson, uriMgmt, uriShared, uriAppsvcs, uriDeclare, tenant)
@@ -68,10 +86,12 @@ func (b *BigIQ) PostAs3BigIQ(as3NewJson string, tenantFilter string) (error, str
 	respRef := make(map[string]interface{})
 	json.Unmarshal(resp, &respRef)
 	respID := respRef["id"].(string)
+	*polls++
 	taskStatus, err := b.getas3TaskStatus(respID)
 	respCode := taskStatus["results"].([]interface{})[0].(map[string]interface{})["code"].(float64)
 	log.Printf("[DEBUG]Code = %+v,ID = %+v", respCode, respID)
 	for respCode != 200 {
+		*polls++
 		fastTask, err := b.getas3TaskStatus(respID)
 		if err != nil {
 			return err, "", respID
@@ -126,11 +146,13 @@ func (b *BigIQ) PostAs3BigIQ(as3NewJson string, tenantFilter string) (error, str
 			}
 			if len(taskIds) == 0 {
 				time.Sleep(2 * time.Second)
-				return b.PostAs3BigIQ(as3NewJson, tenantFilter)
+				b.metrics().IncRetry(TaskAS3)
+				return b.postAs3BigIQ(as3NewJson, tenantFilter, polls)
 			}
 			for _, id := range taskIds {
 				if b.pollingStatus(id) {
-					return b.PostAs3BigIQ(as3NewJson, tenantFilter)
+					b.metrics().IncRetry(TaskAS3)
+					return b.postAs3BigIQ(as3NewJson, tenantFilter, polls)
 				}
 			}
 		}
@@ -140,6 +162,14 @@ func (b *BigIQ) PostAs3BigIQ(as3NewJson string, tenantFilter string) (error, str
 }
 
 func (b *BigIQ) DeleteAs3BigIQ(tenantName string) (error, string) {
+	start, polls := time.Now(), 0
+	err, failed := b.deleteAs3BigIQ(tenantName, &polls)
+	b.observeAS3Task(polls, start)
+	b.recordTeem(TeemAS3Delete, start, err)
+	return err, failed
+}
+
+func (b *BigIQ) deleteAs3BigIQ(tenantName string, polls *int) (error, string) {
 	tenant := tenantName + "?async=true"
 	failedTenants := make([]string, 0)
 	resp, err := b.deleteReq(uriMgmt, uriShared, uriAppsvcs, uriDeclare, tenant)
@@ -149,10 +179,12 @@ func (b *BigIQ) DeleteAs3BigIQ(tenantName string) (error, string) {
 	respRef := make(map[string]interface{})
 	json.Unmarshal(resp, &respRef)
 	respID := respRef["id"].(string)
+	*polls++
 	taskStatus, err := b.getas3Taskstatus(respID)
 	respCode := taskStatus.Results[0].Code
 	log.Printf("[DEBUG]Delete Code = %v,ID = %v", respCode, respID)
 	for respCode != 200 {
+		*polls++
 		fastTask, err := b.getas3Taskstatus(respID)
 		if err != nil {
 			return err, ""
@@ -199,11 +231,13 @@ func (b *BigIQ) DeleteAs3BigIQ(tenantName string) (error, string) {
 			}
 			if len(taskIds) == 0 {
 				time.Sleep(2 * time.Second)
-				return b.DeleteAs3BigIQ(tenantName)
+				b.metrics().IncRetry(TaskAS3)
+				return b.deleteAs3BigIQ(tenantName, polls)
 			}
 			for _, id := range taskIds {
 				if b.pollingStatus(id) {
-					return b.DeleteAs3BigIQ(tenantName)
+					b.metrics().IncRetry(TaskAS3)
+					return b.deleteAs3BigIQ(tenantName, polls)
 				}
 			}
 		}
@@ -214,6 +248,13 @@ func (b *BigIQ) DeleteAs3BigIQ(tenantName string) (error, string) {
 
 }
 func (b *BigIQ) ModifyAs3(tenantFilter string, as3_json string) error {
+	start, polls := time.Now(), 0
+	err := b.modifyAs3(tenantFilter, as3_json, &polls)
+	b.observeAS3Task(polls, start)
+	return err
+}
+
+func (b *BigIQ) modifyAs3(tenantFilter string, as3_json string, polls *int) error {
 	tenant := tenantFilter + "?async=true"
 	resp, err := b.fastPatch(as3_json, uriMgmt, uriShared, uriAppsvcs, uriDeclare, tenant)
 	if err != nil {
@@ -222,9 +263,11 @@ func (b *BigIQ) ModifyAs3(tenantFilter string, as3_json string) error {
 	respRef := make(map[string]interface{})
 	json.Unmarshal(resp, &respRef)
 	respID := respRef["id"].(string)
+	*polls++
 	taskStatus, err := b.getas3Taskstatus(respID)
 	respCode := taskStatus.Results[0].Code
 	for respCode != 200 {
+		*polls++
 		fastTask, err := b.getas3Taskstatus(respID)
 		if err != nil {
 			return err
@@ -241,7 +284,8 @@ func (b *BigIQ) ModifyAs3(tenantFilter string, as3_json string) error {
 			}
 			for _, id := range taskIds {
 				if b.pollingStatus(id) {
-					return b.ModifyAs3(tenantFilter, as3_json)
+					b.metrics().IncRetry(TaskAS3)
+					return b.modifyAs3(tenantFilter, as3_json, polls)
 				}
 			}
 		}
@@ -0,0 +1,236 @@
+package bigiq
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// LicenseAssignment is a device licensed from any pool type: a member of a
+// regkey pool offering, a purchased pool or a utility offering.
+type LicenseAssignment struct {
+	PoolType string `json:"poolType"`
+	PoolName string `json:"poolName"`
+	PoolID   string `json:"poolId"`
+	// Offering is the registration key for regkey pools, the base
+	// registration key for purchased pools and the offering ID for
+	// utility licenses.
+	Offering        string              `json:"offering,omitempty"`
+	SKU             string              `json:"sku,omitempty"`
+	MemberID        string              `json:"memberId"`
+	DeviceAddress   string              `json:"deviceAddress,omitempty"`
+	DeviceName      string              `json:"deviceName,omitempty"`
+	DeviceMachineID string              `json:"deviceMachineId,omitempty"`
+	MacAddress      string              `json:"macAddress,omitempty"`
+	Status          LicenseMemberStatus `json:"status,omitempty"`
+	// LastUpdate is when BIG-IQ last changed the membership.
+	LastUpdate time.Time `json:"lastUpdate,omitempty"`
+}
+
+// Actions reported by EnsureLicensed.
+const (
+	EnsureUnchanged  = "unchanged"
+	EnsureAssigned   = "assigned"
+	EnsureMigrated   = "migrated"
+	EnsureReassigned = "reassigned"
+)
+
+// EnsureResult is the outcome of EnsureLicensed.
+type EnsureResult struct {
+	Assignment *LicenseAssignment
+	Action     string
+	Changed    bool
+}
+
+// microsToTime converts BIG-IQ's lastUpdateMicros to a time, leaving zero
+// unset.
+func microsToTime(micros int64) time.Time {
+	if micros == 0 {
+		return time.Time{}
+	}
+	return time.UnixMicro(micros)
+}
+
+// matches reports whether the assignment belongs to the device with any of
+// the given address, MAC address or machine ID. Empty values never match.
+func (a *LicenseAssignment) matches(address, mac, machineID string) bool {
+	return (address != "" && a.DeviceAddress == address) ||
+		(mac != "" && strings.EqualFold(a.MacAddress, mac)) ||
+		(machineID != "" && a.DeviceMachineID == machineID)
+}
+
+// LicenseAssignments returns every device licensed from the regkey,
+// purchased and utility pools.
+func (b *BigIQ) LicenseAssignments() ([]LicenseAssignment, error) {
+	var assignments []LicenseAssignment
+	err := b.walkLicensePools(func(p *licensePool) error {
+		assignments = append(assignments, p.Members...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return assignments, nil
+}
+
+// FindLicenseAssignment returns the assignment of the device with the given
+// address, MAC address or machine ID, or nil if it is not licensed.
+func (b *BigIQ) FindLicenseAssignment(address, mac, machineID string) (*LicenseAssignment, error) {
+	assignments, err := b.LicenseAssignments()
+	if err != nil {
+		return nil, err
+	}
+	for i := range assignments {
+		if assignments[i].matches(address, mac, machineID) {
+			return &assignments[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// skuMatches reports whether the assignment satisfies the SKU keywords of
+// config. Assignments without a known SKU, such as regkey pool members,
+// satisfy any keywords.
+func (a *LicenseAssignment) skuMatches(config *LicenseParam) bool {
+	if a.SKU == "" {
+		return true
+	}
+	sku := strings.ToUpper(a.SKU)
+	for _, keyword := range []string{config.SkuKeyword1, config.SkuKeyword2} {
+		if keyword != "" && !strings.Contains(sku, strings.ToUpper(keyword)) {
+			return false
+		}
+	}
+	return true
+}
+
+// runLicenseTask submits a member-management task and waits for it to finish.
+func (b *BigIQ) runLicenseTask(ctx context.Context, config *LicenseParam) error {
+	return b.licenseOne(ctx, config).Err
+}
+
+// machineIDOf returns the machine ID of the managed device at address, or ""
+// if BIG-IQ does not manage it.
+func (b *BigIQ) machineIDOf(address string) (string, error) {
+	devices, err := b.GetManagedDevices()
+	if err != nil {
+		return "", err
+	}
+	for _, d := range devices.DevicesInfo {
+		if d.Address == address || d.ManagementAddress == address {
+			return d.MachineID, nil
+		}
+	}
+	return "", nil
+}
+
+// EnsureLicensed makes sure the device described by config holds a license
+// from config.LicensePoolName, without double-assigning. The device is looked
+// up in every pool by address, MAC address and, for managed devices, machine
+// ID. An existing assignment is kept if it is in the requested pool (or no
+// pool is requested) and matches the SKU keywords, unless its installation
+// failed, in which case it is revoked and assigned again; one in another pool
+// is revoked and the device assigned from the requested pool; otherwise the
+// device is assigned. config.Command is ignored. The revoke and assign tasks
+// go through PostLicense, which reports them to Teem. If the assignment fails
+// after the old license was revoked, the error says that the device was left
+// unlicensed.
+func (b *BigIQ) EnsureLicensed(config *LicenseParam) (*EnsureResult, error) {
+	return b.EnsureLicensedContext(context.Background(), config)
+}
+
+// EnsureLicensedContext is EnsureLicensed, which stops waiting for the license
+// tasks once ctx is done.
+func (b *BigIQ) EnsureLicensedContext(ctx context.Context, config *LicenseParam) (*EnsureResult, error) {
+	machineID, err := b.machineIDOf(config.Address)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := b.FindLicenseAssignment(config.Address, config.MacAddress, machineID)
+	if err != nil {
+		return nil, err
+	}
+	action := EnsureAssigned
+	if existing != nil {
+		keep := (config.LicensePoolName == "" || existing.PoolName == config.LicensePoolName) && existing.skuMatches(config)
+		switch {
+		case keep && existing.Status != LicenseMemberInstallationFailed:
+			return &EnsureResult{Assignment: existing, Action: EnsureUnchanged}, nil
+		case keep:
+			log.Printf("[INFO] reassigning license of %s from pool %s after its installation failed", config.Address, existing.PoolName)
+			action = EnsureReassigned
+		default:
+			log.Printf("[INFO] migrating license of %s from pool %s to %s", config.Address, existing.PoolName, config.LicensePoolName)
+			action = EnsureMigrated
+		}
+		revoke := *config
+		revoke.Command = LicenseRevoke
+		revoke.LicensePoolName = existing.PoolName
+		revoke.Address = existing.DeviceAddress
+		if err := b.runLicenseTask(ctx, &revoke); err != nil {
+			return nil, err
+		}
+	}
+	assign := *config
+	assign.Command = LicenseAssign
+	if err := b.runLicenseTask(ctx, &assign); err != nil {
+		if existing != nil {
+			return nil, fmt.Errorf("license of %s was revoked from pool %s, but assigning it again failed and left the device unlicensed: %w", config.Address, existing.PoolName, err)
+		}
+		return nil, err
+	}
+	assignment, err := b.FindLicenseAssignment(config.Address, config.MacAddress, machineID)
+	if err != nil {
+		return nil, err
+	}
+	return &EnsureResult{Assignment: assignment, Action: action, Changed: true}, nil
+}
+
+// memberPath returns the path of the membership behind the assignment.
+func (a *LicenseAssignment) memberPath() []string {
+	switch a.PoolType {
+	case PoolTypePurchased:
+		return purchasedPoolPath(a.PoolID, uriMemb, a.MemberID)
+	case PoolTypeUtility:
+		return utilityLicensePath(a.PoolID, uriOfferings, a.Offering, uriMemb, a.MemberID)
+	}
+	return offeringPath(a.PoolID, a.Offering, uriMembers, a.MemberID)
+}
+
+// RevokeByDevice revokes the license of the device with the given address or
+// machine ID from whichever regkey, purchased or utility pool it is licensed
+// from, and waits until the membership is gone. credentials are required for
+// unmanaged devices and may be nil for managed ones. It returns the
+// assignment that was revoked.
+func (b *BigIQ) RevokeByDevice(ctx context.Context, device string, credentials *UnmanagedDevice) (assignment *LicenseAssignment, err error) {
+	start := time.Now()
+	defer func() { b.recordTeem(TeemLicenseRevoke, start, err) }()
+	assignment, err = b.FindLicenseAssignment(device, "", device)
+	if err != nil {
+		return nil, err
+	}
+	if assignment == nil {
+		return nil, fmt.Errorf("device %s is not licensed from any pool", device)
+	}
+	return assignment, b.revokeAssignment(ctx, assignment, credentials)
+}
+
+// revokeAssignment revokes the membership behind assignment and waits until
+// it is gone.
+func (b *BigIQ) revokeAssignment(ctx context.Context, assignment *LicenseAssignment, credentials *UnmanagedDevice) error {
+	log.Printf("[INFO] revoking license of %s from %s pool %s", assignment.DeviceAddress, assignment.PoolType, assignment.PoolName)
+	path := assignment.memberPath()
+	if err := b.revokeMember(assignment.MemberID, credentials, path...); err != nil {
+		return err
+	}
+	return b.pollTask(ctx, TaskLicenseMember, b.licensePollInterval(), func() (bool, error) {
+		var member LicenseMember
+		err, ok := b.getForEntity(&member, path...)
+		if err != nil {
+			return false, err
+		}
+		return !ok, nil
+	})
+}
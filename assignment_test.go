@@ -0,0 +1,201 @@
+package bigiq
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnsureLicensedKeepsMatchingAssignment(t *testing.T) {
+	posts := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		path := r.URL.Path
+		switch {
+		case r.Method == http.MethodPost:
+			posts++
+		case strings.HasSuffix(path, "/regkey/licenses"):
+			w.Write([]byte(`{"items":[{"id":"pool-1","name":"rk-pool"}]}`))
+		case strings.HasSuffix(path, "/pool-1/offerings"):
+			w.Write([]byte(`{"items":[{"regKey":"KEY-1","status":"READY"}]}`))
+		case strings.HasSuffix(path, "/KEY-1/members"):
+			w.Write([]byte(`{"items":[{"id":"m1","deviceAddress":"10.0.0.9","macAddress":"00:11:22:33:44:55","status":"LICENSED"}]}`))
+		default:
+			w.Write([]byte(`{"items":[]}`))
+		}
+	}))
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+
+	// Matched by MAC address although the device has a new address.
+	result, err := b.EnsureLicensed(&LicenseParam{Address: "10.0.0.10", MacAddress: "00:11:22:33:44:55", LicensePoolName: "rk-pool"})
+
+	assert.Nil(t, err)
+	assert.False(t, result.Changed)
+	assert.Equal(t, EnsureUnchanged, result.Action)
+	assert.Equal(t, "m1", result.Assignment.MemberID)
+	assert.Equal(t, 0, posts)
+}
+
+func TestRevokeByDeviceFindsUtilityMember(t *testing.T) {
+	deleted := false
+	var deletePath string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		path := r.URL.Path
+		switch {
+		case r.Method == http.MethodDelete:
+			deleted = true
+			deletePath = path
+			w.Write([]byte(`{}`))
+		case strings.HasSuffix(path, "/members/m7"):
+			if deleted {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"code":404,"message":"not found"}`))
+				return
+			}
+			w.Write([]byte(`{"id":"m7"}`))
+		case strings.HasSuffix(path, "/utility/licenses"):
+			w.Write([]byte(`{"items":[{"regKey":"UTIL-KEY","name":"utility"}]}`))
+		case strings.HasSuffix(path, "/UTIL-KEY/offerings"):
+			w.Write([]byte(`{"items":[{"id":"off-1","name":"F5-BIG-MSP-BT-10G"}]}`))
+		case strings.HasSuffix(path, "/off-1/members"):
+			w.Write([]byte(`{"items":[{"id":"m7","deviceAddress":"10.1.1.1"}]}`))
+		default:
+			w.Write([]byte(`{"items":[]}`))
+		}
+	}))
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+
+	assignment, err := b.RevokeByDevice(context.Background(), "10.1.1.1", nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, PoolTypeUtility, assignment.PoolType)
+	assert.Equal(t, "utility", assignment.PoolName)
+	assert.Equal(t, "/mgmt/cm/device/licensing/pool/utility/licenses/UTIL-KEY/offerings/off-1/members/m7", deletePath)
+}
+
+func TestUtilityAssignmentPoolNameDefaultsToRegKey(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		path := r.URL.Path
+		switch {
+		case strings.HasSuffix(path, "/utility/licenses"):
+			w.Write([]byte(`{"items":[{"regKey":"UTIL-KEY"}]}`))
+		case strings.HasSuffix(path, "/UTIL-KEY/offerings"):
+			w.Write([]byte(`{"items":[{"id":"off-1","name":"F5-BIG-MSP-BT-10G"}]}`))
+		case strings.HasSuffix(path, "/off-1/members"):
+			w.Write([]byte(`{"items":[{"id":"m7","deviceAddress":"10.1.1.1"}]}`))
+		default:
+			w.Write([]byte(`{"items":[]}`))
+		}
+	}))
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+
+	assignment, err := b.FindLicenseAssignment("10.1.1.1", "", "")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "UTIL-KEY", assignment.PoolName)
+}
+
+func TestEnsureLicensedReassignsFailedInstallation(t *testing.T) {
+	var commands []LicenseCommand
+	status := LicenseMemberInstallationFailed
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		path := r.URL.Path
+		switch {
+		case r.Method == http.MethodPost:
+			var config LicenseParam
+			json.NewDecoder(r.Body).Decode(&config)
+			commands = append(commands, config.Command)
+			if config.Command == LicenseAssign {
+				status = LicenseMemberLicensed
+			}
+			w.Write([]byte(`{"id":"task-1"}`))
+		case strings.HasSuffix(path, "/member-management/task-1"):
+			w.Write([]byte(`{"id":"task-1","status":"FINISHED"}`))
+		case strings.HasSuffix(path, "/regkey/licenses"):
+			w.Write([]byte(`{"items":[{"id":"pool-1","name":"rk-pool"}]}`))
+		case strings.HasSuffix(path, "/pool-1/offerings"):
+			w.Write([]byte(`{"items":[{"regKey":"KEY-1","status":"READY"}]}`))
+		case strings.HasSuffix(path, "/KEY-1/members"):
+			w.Write([]byte(`{"items":[{"id":"m1","deviceAddress":"10.0.0.9","status":"` + string(status) + `"}]}`))
+		default:
+			w.Write([]byte(`{"items":[]}`))
+		}
+	}))
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+
+	result, err := b.EnsureLicensed(&LicenseParam{Address: "10.0.0.9", LicensePoolName: "rk-pool"})
+
+	assert.Nil(t, err)
+	assert.True(t, result.Changed)
+	assert.Equal(t, EnsureReassigned, result.Action)
+	assert.Equal(t, []LicenseCommand{LicenseRevoke, LicenseAssign}, commands)
+	assert.Equal(t, LicenseMemberLicensed, result.Assignment.Status)
+}
+
+func TestEnsureLicensedReportsDeviceLeftUnlicensed(t *testing.T) {
+	var commands []LicenseCommand
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		path := r.URL.Path
+		switch {
+		case r.Method == http.MethodPost:
+			var config LicenseParam
+			json.NewDecoder(r.Body).Decode(&config)
+			commands = append(commands, config.Command)
+			w.Write([]byte(`{"id":"` + string(config.Command) + `"}`))
+		case strings.HasSuffix(path, "/member-management/revoke"):
+			w.Write([]byte(`{"id":"revoke","status":"FINISHED"}`))
+		case strings.HasSuffix(path, "/member-management/assign"):
+			w.Write([]byte(`{"id":"assign","status":"FAILED","errorMessage":"pool exhausted"}`))
+		case strings.HasSuffix(path, "/regkey/licenses"):
+			w.Write([]byte(`{"items":[{"id":"pool-1","name":"old-pool"}]}`))
+		case strings.HasSuffix(path, "/pool-1/offerings"):
+			w.Write([]byte(`{"items":[{"regKey":"KEY-1","status":"READY"}]}`))
+		case strings.HasSuffix(path, "/KEY-1/members"):
+			w.Write([]byte(`{"items":[{"id":"m1","deviceAddress":"10.0.0.9","status":"LICENSED"}]}`))
+		default:
+			w.Write([]byte(`{"items":[]}`))
+		}
+	}))
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+
+	_, err := b.EnsureLicensedContext(context.Background(), &LicenseParam{Address: "10.0.0.9", LicensePoolName: "new-pool"})
+
+	assert.Equal(t, []LicenseCommand{LicenseRevoke, LicenseAssign}, commands)
+	assert.Contains(t, err.Error(), "revoked from pool old-pool")
+	assert.Contains(t, err.Error(), "left the device unlicensed")
+	_, ok := err.(interface{ Unwrap() error })
+	assert.True(t, ok)
+}
+
+func TestEnsureLicensedFailsWhenManagedDevicesAreUnavailable(t *testing.T) {
+	posts := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodPost {
+			posts++
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"code":503,"message":"restjavad unavailable"}`))
+	}))
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+
+	_, err := b.EnsureLicensed(&LicenseParam{Address: "10.0.0.9", LicensePoolName: "rk-pool"})
+
+	assert.Contains(t, err.Error(), "restjavad unavailable")
+	assert.Equal(t, 0, posts)
+}
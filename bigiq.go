@@ -2,6 +2,7 @@ package bigiq
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"errors"
@@ -11,6 +12,7 @@ import (
 	"net/http"
 	"reflect"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -43,6 +45,15 @@ var defaultConfigOptions = &ConfigOptions{
 
 type ConfigOptions struct {
 	APICallTimeout time.Duration
+	// CacheTTL enables response caching for pool and device lookups when
+	// non-zero. See EnableCache.
+	CacheTTL        time.Duration
+	CacheMaxEntries int
+	// Metrics, if set, is installed on sessions created with these options.
+	Metrics Metrics
+	// LicensePollInterval is the delay between polls of license tasks and
+	// members. Defaults to 2 seconds.
+	LicensePollInterval time.Duration
 }
 
 // BigIQ is a container for our session state.
@@ -53,9 +64,25 @@ type BigIQ struct {
 	Token     string // if set, will be used instead of User/Password
 	Transport *http.Transport
 	// UserAgent is an optional field that specifies the caller of this request.
-	UserAgent     string
+	UserAgent string
+	// ProductTokens are appended to the User-Agent header after UserAgent,
+	// e.g. "my-pipeline/1.2".
+	ProductTokens []string
+	// CorrelationID, if set, is sent in CorrelationHeader (X-Correlation-ID
+	// by default) and in the User-Agent of every request.
+	CorrelationID     string
+	CorrelationHeader string
+	// Teem enables usage telemetry for licensing and AS3 operations, which is
+	// reported to TeemSink. Nothing is collected when Teem is false.
 	Teem          bool
+	TeemSink      TeemSink
 	ConfigOptions *ConfigOptions
+	// Metrics receives request, retry, task and upload instrumentation.
+	Metrics Metrics
+
+	cache *responseCache
+	teem  *teemState
+	auth  *tokenAuth
 }
 
 // APIRequest builds our request before sending it to the server.
@@ -64,6 +91,8 @@ type APIRequest struct {
 	URL         string
 	Body        string
 	ContentType string
+	// Headers are additional request headers, e.g. If-Match.
+	Headers map[string]string
 }
 
 // Upload contains information about a file upload status
@@ -145,17 +174,73 @@ type deviceInfo struct {
 }
 
 type MembersList struct {
-	Members []memberDetail `json:"items"`
+	Members []LicenseMember `json:"items"`
+}
+
+// LicenseTaskStatus is the status of a member-management license task.
+type LicenseTaskStatus string
+
+const (
+	LicenseTaskStarted  LicenseTaskStatus = "STARTED"
+	LicenseTaskFinished LicenseTaskStatus = "FINISHED"
+	LicenseTaskFailed   LicenseTaskStatus = "FAILED"
+)
+
+// LicenseTask is a member-management task, as returned by PostLicense and
+// GetLicenseStatus.
+type LicenseTask struct {
+	ID                         string            `json:"id"`
+	Status                     LicenseTaskStatus `json:"status"`
+	Command                    string            `json:"command,omitempty"`
+	Address                    string            `json:"address,omitempty"`
+	AssignmentType             string            `json:"assignmentType,omitempty"`
+	LicensePoolName            string            `json:"licensePoolName,omitempty"`
+	MacAddress                 string            `json:"macAddress,omitempty"`
+	Hypervisor                 string            `json:"hypervisor,omitempty"`
+	SkuKeyword1                string            `json:"skuKeyword1,omitempty"`
+	UnitOfMeasure              string            `json:"unitOfMeasure,omitempty"`
+	Tenant                     string            `json:"tenant,omitempty"`
+	Username                   string            `json:"username,omitempty"`
+	UserReference              DeviceRef         `json:"userReference,omitempty"`
+	LicenseAssignmentReference DeviceRef         `json:"licenseAssignmentReference,omitempty"`
+	ErrorMessage               string            `json:"errorMessage,omitempty"`
+	StartDateTime              string            `json:"startDateTime,omitempty"`
+	EndDateTime                string            `json:"endDateTime,omitempty"`
+	SelfLink                   string            `json:"selfLink,omitempty"`
+}
+
+// LicenseMemberStatus is the status of a device licensed from a pool.
+type LicenseMemberStatus string
+
+const (
+	LicenseMemberInstalling         LicenseMemberStatus = "INSTALLING"
+	LicenseMemberLicensed           LicenseMemberStatus = "LICENSED"
+	LicenseMemberInstallationFailed LicenseMemberStatus = "INSTALLATION_FAILED"
+)
+
+// LicenseMember is a device licensed from a regkey pool offering.
+type LicenseMember struct {
+	AssignmentType   string              `json:"assignmentType"`
+	DeviceAddress    string              `json:"deviceAddress"`
+	DeviceMachineID  string              `json:"deviceMachineId"`
+	DeviceName       string              `json:"deviceName"`
+	ID               string              `json:"id"`
+	LastUpdateMicros int64               `json:"lastUpdateMicros,omitempty"`
+	MacAddress       string              `json:"macAddress,omitempty"`
+	Message          string              `json:"message"`
+	Status           LicenseMemberStatus `json:"status"`
+}
+
+// LicenseError is returned when a license task fails or a member fails to
+// install.
+type LicenseError struct {
+	ID      string
+	Status  string
+	Message string
 }
 
-type memberDetail struct {
-	AssignmentType  string `json:"assignmentType"`
-	DeviceAddress   string `json:"deviceAddress"`
-	DeviceMachineID string `json:"deviceMachineId"`
-	DeviceName      string `json:"deviceName"`
-	ID              string `json:"id"`
-	Message         string `json:"message"`
-	Status          string `json:"status"`
+func (e *LicenseError) Error() string {
+	return fmt.Sprintf("license %s %s: %s", e.ID, e.Status, e.Message)
 }
 
 type regKeyAssignStatus struct {
@@ -167,35 +252,36 @@ type regKeyAssignStatus struct {
 }
 
 type LicenseDetails struct {
-	RegKey string `json:"regKey"`
-	Name   string `json:"name"`
-	Status string `json:"status"`
+	RegKey string           `json:"regKey"`
+	Name   string           `json:"name"`
+	Status ActivationStatus `json:"status"`
 }
 
 type LicenseParam struct {
-	Address         string `json:"address,omitempty"`
-	Port            int    `json:"port,omitempty"`
-	AssignmentType  string `json:"assignmentType,omitempty"`
-	Command         string `json:"command,omitempty"`
-	Hypervisor      string `json:"hypervisor,omitempty"`
-	LicensePoolName string `json:"licensePoolName,omitempty"`
-	MacAddress      string `json:"macAddress,omitempty"`
-	Password        string `json:"password,omitempty"`
-	SkuKeyword1     string `json:"skuKeyword1,omitempty"`
-	SkuKeyword2     string `json:"skuKeyword2,omitempty"`
-	Tenant          string `json:"tenant,omitempty"`
-	UnitOfMeasure   string `json:"unitOfMeasure,omitempty"`
-	User            string `json:"user,omitempty"`
+	Address         string         `json:"address,omitempty"`
+	Port            int            `json:"port,omitempty"`
+	AssignmentType  AssignmentType `json:"assignmentType,omitempty"`
+	Command         LicenseCommand `json:"command,omitempty"`
+	Hypervisor      Hypervisor     `json:"hypervisor,omitempty"`
+	LicensePoolName string         `json:"licensePoolName,omitempty"`
+	MacAddress      string         `json:"macAddress,omitempty"`
+	Password        string         `json:"password,omitempty"`
+	SkuKeyword1     string         `json:"skuKeyword1,omitempty"`
+	SkuKeyword2     string         `json:"skuKeyword2,omitempty"`
+	Tenant          string         `json:"tenant,omitempty"`
+	UnitOfMeasure   string         `json:"unitOfMeasure,omitempty"`
+	User            string         `json:"user,omitempty"`
 }
 
 type LicenseEula struct {
-	Status string `json:"status"`
-	Eula   string `json:"eulaText"`
+	Status ActivationStatus `json:"status"`
+	Eula   string           `json:"eulaText"`
 }
 
 type RegPool struct {
 	Description string `json:"description"`
 	Name        string `json:"name"`
+	Generation  int    `json:"generation,omitempty"`
 }
 
 type BigiqAs3AllTaskType struct {
@@ -217,137 +303,104 @@ type BigiqResults struct {
 	RunTime int64  `json:"runTime,omitempty"`
 }
 
-func (b *BigIQ) InitialActivation(regkey, name, status string) (string, error) {
-	license := LicenseDetails{
-		RegKey: regkey,
-		Name:   name,
-		Status: status,
-	}
-	licResp, err := b.postReq(license, uriMgmt, uriCm, uriDevice, uriLicensing, uriPool, uriInitActivation)
-	respRef := make(map[string]interface{})
-	_ = json.Unmarshal(licResp, &respRef)
+const defaultLicensePollInterval = 2 * time.Second
 
-	if err != nil {
-		errMsg := respRef["message"].(string)
-		return errMsg, err
+func (b *BigIQ) licensePollInterval() time.Duration {
+	if b.ConfigOptions != nil && b.ConfigOptions.LicensePollInterval > 0 {
+		return b.ConfigOptions.LicensePollInterval
 	}
-	time.Sleep(5 * time.Second)
-	statusMsg := respRef["message"].(string)
-	return statusMsg, nil
+	return defaultLicensePollInterval
 }
 
-// TODO: does this need TaskId or SoftLink?
-func (b *BigIQ) PollActivation(regkey string) (string, error) {
-	respRef := make(map[string]interface{})
-	err, _ := b.getForEntity(&respRef, uriMgmt, uriCm, uriDevice, uriLicensing, uriPool, uriInitActivation, regkey)
-	if err != nil {
-		return "", err
-	}
-	pollStatus, ok := respRef["status"]
-	if ok {
-		pollStatus = pollStatus.(string)
-		if pollStatus == activationManual {
-			log.Printf("[INFO] %v for REG-KEY: %s", activationManual, regkey)
-		} else {
-			return b.AcceptEULA(regkey)
-		}
-	} else {
-		return "", fmt.Errorf("license status not available")
-	}
-	return pollStatus.(string), err
-}
+// licenseTaskGrace is how long GetLicenseStatus and GenerateUsageReport wait
+// for a task they cannot find yet, since a new task is not visible
+// immediately after it is posted.
+var licenseTaskGrace = 30 * time.Second
 
-// TODO: does this need TaskId?
-func (b *BigIQ) GetDossier(regkey string) (string, error) {
-	respRef := make(map[string]interface{})
-	err, _ := b.getForEntity(&respRef, uriMgmt, uriCm, uriDevice, uriLicensing, uriPool, uriInitActivation, regkey)
-	if err != nil {
-		return "", nil
-	}
-	return respRef["dossier"].(string), nil
+func (b *BigIQ) PostLicense(config *LicenseParam) (string, error) {
+	return b.PostLicenseContext(context.Background(), config)
 }
 
-// AcceptEULA TODO: add RegPool calls and what do I return? HTTPError and what else?
-func (b *BigIQ) AcceptEULA(regkey string) (string, error) {
-	respRef := make(map[string]interface{})
-	err, _ := b.getForEntity(&respRef, uriMgmt, uriCm, uriDevice, uriLicensing, uriPool, uriInitActivation, regkey)
-	if err != nil {
+// PostLicenseContext is PostLicense, which does not post once ctx is done.
+func (b *BigIQ) PostLicenseContext(ctx context.Context, config *LicenseParam) (string, error) {
+	if err := b.validateLicenseParam(config); err != nil {
 		return "", err
-	} else {
-		patchRef := LicenseEula{
-			Status: activationAutoEULA,
-			Eula:   respRef["eulaText"].(string),
-		}
-		return "", b.patch(patchRef, uriMgmt, uriCm, uriDevice, uriLicensing, uriPool, uriInitActivation, regkey)
-	}
-}
-
-func (b *BigIQ) RetryActivation(regkey string) (string, error) {
-	licResp, err := b.fastPatch(uriMgmt, uriCm, uriDevice, uriLicensing, uriPool, uriInitActivation, regkey)
-	if err != nil {
-		return "dragons here", err
 	}
-	fmt.Println(licResp)
-	return "", nil
-}
-
-func (b *BigIQ) RemoveActivation(regkey string) (string, error) {
-	licResp, err := b.deleteReq(uriMgmt, uriCm, uriDevice, uriLicensing, uriPool, uriInitActivation, regkey)
-	if err != nil {
-		return "dragons here", err
+	if err := ctx.Err(); err != nil {
+		return "", err
 	}
-	respRef := make(map[string]interface{})
-	_ = json.Unmarshal(licResp, &respRef)
-	respID := respRef["id"].(string)
-	time.Sleep(5 * time.Second)
-	return respID, nil
-}
-
-func (b *BigIQ) PostLicense(config *LicenseParam) (string, error) {
 	log.Printf("[INFO] %v license to BigIP device:%v from BIGIQ", config.Command, config.Address)
+	start := time.Now()
 	resp, err := b.postReq(config, uriMgmt, uriCm, uriDevice, uriTasks, uriLicensing, uriPool, uriManagement)
+	b.recordTeem(teemLicenseOperation(config.Command), start, err)
 	if err != nil {
 		return "", err
 	}
-	respRef := make(map[string]interface{})
-	_ = json.Unmarshal(resp, &respRef)
-	respID := respRef["id"].(string)
-	time.Sleep(5 * time.Second)
-	return respID, nil
-}
-
-func (b *BigIQ) GetLicenseStatus(id string) (map[string]interface{}, error) {
-	licRes := make(map[string]interface{})
-	err, _ := b.getForEntity(&licRes, uriMgmt, uriCm, uriDevice, uriTasks, uriLicensing, uriPool, uriManagement, id)
-	if err != nil {
-		return nil, err
+	var task LicenseTask
+	if err := json.Unmarshal(resp, &task); err != nil {
+		return "", err
 	}
-	licStatus, ok := licRes["status"]
-	if ok {
-		licStatus = licStatus.(string)
-	} else {
-		return nil, fmt.Errorf("license status not available")
+	if task.ID == "" {
+		return "", fmt.Errorf("license task id not found in response")
 	}
-	for licStatus != "FINISHED" {
-		//log.Printf(" status response is :%s", licStatus)
-		if licStatus == "FAILED" {
+	return task.ID, nil
+}
+
+// GetLicenseStatus waits for the license task id to finish. A FAILED task is
+// returned together with a *LicenseError.
+func (b *BigIQ) GetLicenseStatus(id string) (*LicenseTask, error) {
+	return b.GetLicenseStatusContext(context.Background(), id)
+}
+
+// GetLicenseStatusContext is GetLicenseStatus, which gives up when ctx is
+// done or when the task is still not found after a short grace period.
+func (b *BigIQ) GetLicenseStatusContext(ctx context.Context, id string) (*LicenseTask, error) {
+	var task LicenseTask
+	start := time.Now()
+	err := b.pollTask(ctx, TaskLicense, b.licensePollInterval(), func() (bool, error) {
+		task = LicenseTask{}
+		err, ok := b.getForEntity(&task, uriMgmt, uriCm, uriDevice, uriTasks, uriLicensing, uriPool, uriManagement, id)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			// The task is not visible immediately after it is posted.
+			if time.Since(start) > licenseTaskGrace {
+				return false, fmt.Errorf("license task %s not found", id)
+			}
+			return false, nil
+		}
+		switch task.Status {
+		case LicenseTaskFailed:
 			log.Println("[ERROR]License assign/revoke status failed")
-			return licRes, nil
+			return false, &LicenseError{ID: id, Status: string(task.Status), Message: task.ErrorMessage}
+		case "":
+			return false, fmt.Errorf("license status not available")
 		}
-		return b.GetLicenseStatus(id)
+		return task.Status == LicenseTaskFinished, nil
+	})
+	if err != nil {
+		if task.Status == LicenseTaskFailed {
+			return &task, err
+		}
+		return nil, err
 	}
-	log.Printf("License Assignment is :%s", licStatus)
-	return licRes, nil
+	log.Printf("License Assignment is :%s", task.Status)
+	return &task, nil
 }
 
 func (b *BigIQ) GetDeviceLicenseStatus(path ...string) (string, error) {
-	licRes := make(map[string]interface{})
+	var licRes struct {
+		Status string `json:"status"`
+	}
 	err, _ := b.getForEntity(&licRes, path...)
 	if err != nil {
 		return "", err
 	}
-	//log.Printf(" Initial status response is :%s", licRes["status"])
-	return licRes["status"].(string), nil
+	if licRes.Status == "" {
+		return "", fmt.Errorf("license status not available")
+	}
+	return licRes.Status, nil
 }
 
 // TODO: need to return json/map for details of creation
@@ -407,7 +460,7 @@ func (b *BigIQ) GetRegPools() (*regKeyPools, error) {
 
 func (b *BigIQ) GetPoolType(poolName string) (*regKeyPool, error) {
 	var self regKeyPools
-	err, _ := b.getForEntity(&self, uriMgmt, uriCm, uriDevice, uriLicensing, uriPool, uriRegkey, uriLicenses)
+	err, _ := b.getForEntityCached(&self, uriMgmt, uriCm, uriDevice, uriLicensing, uriPool, uriRegkey, uriLicenses)
 	if err != nil {
 		return nil, err
 	}
@@ -430,7 +483,7 @@ func (b *BigIQ) GetManagedDevices() (*devicesList, error) {
 
 func (b *BigIQ) GetDeviceId(deviceName string) (string, error) {
 	var self devicesList
-	err, _ := b.getForEntity(&self, uriMgmt, uriShared, uriResolver, uriDevicegroup, uriCmBigIQ, uriDevices)
+	err, _ := b.getForEntityCached(&self, uriMgmt, uriShared, uriResolver, uriDevicegroup, uriCmBigIQ, uriDevices)
 	if err != nil {
 		return "", err
 	}
@@ -446,7 +499,7 @@ func (b *BigIQ) GetDeviceId(deviceName string) (string, error) {
 
 func (b *BigIQ) GetRegkeyPoolId(poolName string) (string, error) {
 	var self regKeyPools
-	err, _ := b.getForEntity(&self, uriMgmt, uriCm, uriDevice, uriLicensing, uriPool, uriRegkey, uriLicenses)
+	err, _ := b.getForEntityCached(&self, uriMgmt, uriCm, uriDevice, uriLicensing, uriPool, uriRegkey, uriLicenses)
 	if err != nil {
 		return "", err
 	}
@@ -458,7 +511,9 @@ func (b *BigIQ) GetRegkeyPoolId(poolName string) (string, error) {
 	return "", nil
 }
 
-func (b *BigIQ) RegkeylicenseAssign(config interface{}, poolId string, regKey string) (*memberDetail, error) {
+func (b *BigIQ) RegkeylicenseAssign(config interface{}, poolId string, regKey string) (member *LicenseMember, err error) {
+	start := time.Now()
+	defer func() { b.recordTeem(TeemLicenseAssign, start, err) }()
 	resp, err := b.postReq(config, uriMgmt, uriCm, uriDevice, uriLicensing, uriPool, uriRegkey, uriLicenses, poolId, uriOfferings, regKey, uriMembers)
 	if err != nil {
 		return nil, err
@@ -471,24 +526,37 @@ func (b *BigIQ) RegkeylicenseAssign(config interface{}, poolId string, regKey st
 	return b.GetMemberStatus(poolId, regKey, resp1.ID)
 }
 
-func (b *BigIQ) GetMemberStatus(poolId, regKey, memId string) (*memberDetail, error) {
-	var self memberDetail
-	err, _ := b.getForEntity(&self, uriMgmt, uriCm, uriDevice, uriLicensing, uriPool, uriRegkey, uriLicenses, poolId, uriOfferings, regKey, uriMembers, memId)
-	if err != nil {
-		return nil, err
-	}
-	for self.Status != "LICENSED" {
+// GetMemberStatus waits for a regkey pool member to be licensed. A member that
+// fails to install is returned together with a *LicenseError.
+func (b *BigIQ) GetMemberStatus(poolId, regKey, memId string) (*LicenseMember, error) {
+	var self LicenseMember
+	err := b.pollTask(context.Background(), TaskLicenseMember, b.licensePollInterval(), func() (bool, error) {
+		err, _ := b.getForEntity(&self, uriMgmt, uriCm, uriDevice, uriLicensing, uriPool, uriRegkey, uriLicenses, poolId, uriOfferings, regKey, uriMembers, memId)
+		if err != nil {
+			return false, err
+		}
+		if self.Status == LicenseMemberLicensed {
+			return true, nil
+		}
 		log.Printf("Member status:%+v", self.Status)
-		if self.Status == "INSTALLATION_FAILED" {
-			return &self, fmt.Errorf("INSTALLATION_FAILED with %s", self.Message)
+		if self.Status == LicenseMemberInstallationFailed {
+			return false, &LicenseError{ID: memId, Status: string(self.Status), Message: self.Message}
+		}
+		return false, nil
+	})
+	if err != nil {
+		if self.Status == LicenseMemberInstallationFailed {
+			return &self, err
 		}
-		return b.GetMemberStatus(poolId, regKey, memId)
+		return nil, err
 	}
 	return &self, nil
 }
-func (b *BigIQ) RegkeylicenseRevoke(poolId, regKey, memId string) error {
+func (b *BigIQ) RegkeylicenseRevoke(poolId, regKey, memId string) (err error) {
+	start := time.Now()
+	defer func() { b.recordTeem(TeemLicenseRevoke, start, err) }()
 	log.Printf("Deleting License for Member:%+v", memId)
-	_, err := b.deleteReq(uriMgmt, uriCm, uriDevice, uriLicensing, uriPool, uriRegkey, uriLicenses, poolId, uriOfferings, regKey, uriMembers, memId)
+	_, err = b.deleteReq(uriMgmt, uriCm, uriDevice, uriLicensing, uriPool, uriRegkey, uriLicenses, poolId, uriOfferings, regKey, uriMembers, memId)
 	if err != nil {
 		return err
 	}
@@ -500,9 +568,11 @@ func (b *BigIQ) RegkeylicenseRevoke(poolId, regKey, memId string) error {
 	log.Printf("Response after delete:%+v", r1)
 	return nil
 }
-func (b *BigIQ) LicenseRevoke(config interface{}, poolId, regKey, memId string) error {
+func (b *BigIQ) LicenseRevoke(config interface{}, poolId, regKey, memId string) (err error) {
+	start := time.Now()
+	defer func() { b.recordTeem(TeemLicenseRevoke, start, err) }()
 	log.Printf("Deleting License for Member:%+v from LicenseRevoke", memId)
-	_, err := b.deleteReqBody(config, uriMgmt, uriCm, uriDevice, uriLicensing, uriPool, uriRegkey, uriLicenses, poolId, uriOfferings, regKey, uriMembers, memId)
+	_, err = b.deleteReqBody(config, uriMgmt, uriCm, uriDevice, uriLicensing, uriPool, uriRegkey, uriLicenses, poolId, uriOfferings, regKey, uriMembers, memId)
 	if err != nil {
 		return err
 	}
@@ -514,7 +584,9 @@ func (b *BigIQ) LicenseRevoke(config interface{}, poolId, regKey, memId string)
 	log.Printf("Response after delete:%+v", r1)
 	return nil
 }
-func (b *BigIQ) PostAs3Bigiq(as3NewJson string) (error, string) {
+func (b *BigIQ) PostAs3Bigiq(as3NewJson string) (err error, tenants string) {
+	start := time.Now()
+	defer func() { b.recordTeem(TeemAS3Deploy, start, err) }()
 	resp, err := b.postReq(as3NewJson, uriMgmt, uriShared, uriAppsvcs, uriDeclare)
 	if err != nil {
 		return err, ""
@@ -652,7 +724,10 @@ func (b *BigIQ) DeleteAs3Bigiq(as3NewJson string, tenantName string) (error, str
 		log.Println("[ERROR] Error in trimming the as3 json")
 		return err, ""
 	}
-	return b.post(as3Json, uriMgmt, uriShared, uriAppsvcs, uriDeclare), ""
+	start := time.Now()
+	err = b.post(as3Json, uriMgmt, uriShared, uriAppsvcs, uriDeclare)
+	b.recordTeem(TeemAS3Delete, start, err)
+	return err, ""
 }
 
 func tenantTrimToDelete(resp string) (string, error) {
@@ -706,7 +781,7 @@ func NewSession(host, port, user, passwd string, configOptions *ConfigOptions) *
 	if configOptions == nil {
 		configOptions = defaultConfigOptions
 	}
-	return &BigIQ{
+	b := &BigIQ{
 		Host:     url,
 		User:     user,
 		Password: passwd,
@@ -716,7 +791,12 @@ func NewSession(host, port, user, passwd string, configOptions *ConfigOptions) *
 			},
 		},
 		ConfigOptions: configOptions,
+		Metrics:       configOptions.Metrics,
 	}
+	if configOptions.CacheTTL > 0 {
+		b.EnableCache(configOptions.CacheTTL, configOptions.CacheMaxEntries)
+	}
+	return b
 }
 
 // NewTokenSession sets up our connection to the BIG-IQ system, and
@@ -725,64 +805,127 @@ func NewSession(host, port, user, passwd string, configOptions *ConfigOptions) *
 // provider, such as Radius or Active Directory. loginProviderName is
 // probably "tmos" but your environment may vary.
 func NewTokenSession(host, port, user, passwd, loginProviderName string, configOptions *ConfigOptions) (b *BigIQ, err error) {
-	type authReq struct {
-		Username          string `json:"username"`
-		Password          string `json:"password"`
-		LoginProviderName string `json:"loginProviderName"`
-	}
+	b = NewSession(host, port, user, passwd, configOptions)
+	b.auth = &tokenAuth{login: tokenLogin{
+		Username:          user,
+		Password:          passwd,
+		LoginProviderName: loginProviderName,
+	}}
+	b.auth.mu.Lock()
+	defer b.auth.mu.Unlock()
+	err = b.acquireToken()
+	return
+}
+
+const uriLogin = "mgmt/shared/authn/login"
+
+type tokenLogin struct {
+	Username          string `json:"username"`
+	Password          string `json:"password"`
+	LoginProviderName string `json:"loginProviderName"`
+}
+
+// tokenAuth is the state of a token session. It keeps the login so that an
+// expired token can be re-acquired, and is shared with the copies made by
+// WithCorrelationID.
+type tokenAuth struct {
+	mu    sync.Mutex
+	login tokenLogin
+	token string
+}
+
+// acquireToken logs in with the credentials of the token session and stores
+// the new token. The caller holds b.auth.mu.
+func (b *BigIQ) acquireToken() error {
 	type authResp struct {
 		Token struct {
 			Token string
 		}
 	}
 
-	auth := authReq{
-		user,
-		passwd,
-		loginProviderName,
-	}
-
-	marshalJSON, err := json.Marshal(auth)
+	marshalJSON, err := json.Marshal(b.auth.login)
 	if err != nil {
-		return
+		return err
 	}
 
 	req := &APIRequest{
 		Method:      "post",
-		URL:         "mgmt/shared/authn/login",
+		URL:         uriLogin,
 		Body:        string(marshalJSON),
 		ContentType: "application/json",
 	}
 
-	b = NewSession(host, port, user, passwd, configOptions)
 	resp, err := b.APICall(req)
 	if err != nil {
-		return
-	}
-
-	if resp == nil {
-		err = fmt.Errorf("unable to acquire authentication token")
-		return
+		return err
 	}
 
 	var aresp authResp
-	err = json.Unmarshal(resp, &aresp)
-	if err != nil {
-		return
+	if resp != nil {
+		if err := json.Unmarshal(resp, &aresp); err != nil {
+			return err
+		}
 	}
-
 	if aresp.Token.Token == "" {
-		err = fmt.Errorf("unable to acquire authentication token")
-		return
+		return fmt.Errorf("unable to acquire authentication token")
 	}
 
+	b.auth.token = aresp.Token.Token
 	b.Token = aresp.Token.Token
+	return nil
+}
 
-	return
+// refreshToken re-acquires the token of a token session after the token in
+// use was rejected. Concurrent callers that saw the same rejected token share
+// a single login.
+func (b *BigIQ) refreshToken(rejected string) error {
+	b.auth.mu.Lock()
+	defer b.auth.mu.Unlock()
+	if b.auth.token != rejected {
+		return nil
+	}
+	if err := b.acquireToken(); err != nil {
+		return err
+	}
+	b.metrics().IncTokenRefresh()
+	return nil
+}
+
+func (b *BigIQ) currentToken() string {
+	if b.auth == nil {
+		return b.Token
+	}
+	b.auth.mu.Lock()
+	defer b.auth.mu.Unlock()
+	return b.auth.token
 }
 
 // APICall is used to query the BIG-IQ web API.
 func (b *BigIQ) APICall(options *APIRequest) ([]byte, error) {
+	data, _, err := b.apiCall(options)
+	return data, err
+}
+
+// apiCall sends the request and also returns the response, whose body has
+// already been read and closed, so that callers can inspect the status code
+// and headers. The response is nil if the request could not be sent.
+func (b *BigIQ) apiCall(options *APIRequest) ([]byte, *http.Response, error) {
+	if options.URL == uriLogin {
+		return b.send(options, "")
+	}
+	token := b.currentToken()
+	data, res, err := b.send(options, token)
+	if res != nil && res.StatusCode == http.StatusUnauthorized && b.auth != nil {
+		log.Printf("[DEBUG] authentication token rejected, logging in again")
+		if refreshErr := b.refreshToken(token); refreshErr != nil {
+			return data, res, refreshErr
+		}
+		return b.send(options, b.currentToken())
+	}
+	return data, res, err
+}
+
+func (b *BigIQ) send(options *APIRequest, token string) ([]byte, *http.Response, error) {
 	var req *http.Request
 	client := &http.Client{
 		Transport: b.Transport,
@@ -797,36 +940,52 @@ func (b *BigIQ) APICall(options *APIRequest) ([]byte, error) {
 	url := fmt.Sprintf(format, b.Host, options.URL)
 	body := bytes.NewReader([]byte(options.Body))
 	req, _ = http.NewRequest(strings.ToUpper(options.Method), url, body)
-	if b.Token != "" {
-		req.Header.Set("X-F5-Auth-Token", b.Token)
-	} else if options.URL != "mgmt/shared/authn/login" {
-		req.SetBasicAuth(b.User, b.Password)
+	if options.URL != uriLogin {
+		if token != "" {
+			req.Header.Set("X-F5-Auth-Token", token)
+		} else {
+			req.SetBasicAuth(b.User, b.Password)
+		}
 	}
 
+	b.setClientHeaders(req)
+
 	//fmt.Println("REQ -- ", options.Method, " ", url," -- ",options.Body)
 
 	if len(options.ContentType) > 0 {
 		req.Header.Set("Content-Type", options.ContentType)
 	}
+	for k, v := range options.Headers {
+		req.Header.Set(k, v)
+	}
+
+	if b.cache != nil && req.Method != http.MethodGet {
+		// Invalidate once the write has been answered, so that a GET racing
+		// with it cannot cache the response from before the write.
+		defer b.cache.invalidateWrite(options.URL)
+	}
 
+	start := time.Now()
 	res, err := client.Do(req)
 	if err != nil {
-		return nil, err
+		b.metrics().ObserveRequest(req.Method, PathTemplate(options.URL), 0, time.Since(start))
+		return nil, nil, err
 	}
 
 	defer res.Body.Close()
 
 	data, _ := ioutil.ReadAll(res.Body)
+	b.metrics().ObserveRequest(req.Method, PathTemplate(options.URL), res.StatusCode, time.Since(start))
 
 	if res.StatusCode >= 400 {
 		if res.Header["Content-Type"][0] == "application/json" {
-			return data, b.checkError(data)
+			return data, res, b.checkError(data)
 		}
 
-		return data, errors.New(fmt.Sprintf("HTTP %d :: %s", res.StatusCode, string(data[:])))
+		return data, res, errors.New(fmt.Sprintf("HTTP %d :: %s", res.StatusCode, string(data[:])))
 	}
 
-	return data, nil
+	return data, res, nil
 }
 
 func (b *BigIQ) iControlPath(parts []string) string {
@@ -884,6 +1043,12 @@ func (b *BigIQ) getForEntity(e interface{}, path ...string) (error, bool) {
 	}
 
 	resp, err := b.APICall(req)
+	return b.decodeEntity(e, resp, err)
+}
+
+// decodeEntity unmarshals a GET response into e, treating a 404 as a missing
+// entity rather than an error.
+func (b *BigIQ) decodeEntity(e interface{}, resp []byte, err error) (error, bool) {
 	if err != nil {
 		var reqError RequestError
 		json.Unmarshal(resp, &reqError)
@@ -0,0 +1,98 @@
+package bigiq
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const defaultBulkConcurrency = 4
+
+// BulkOptions controls BulkLicense.
+type BulkOptions struct {
+	// Concurrency is the number of license tasks run at once. Defaults to 4.
+	Concurrency int
+	// OnResult, if set, is called with each device's result as soon as it is
+	// known. Calls are serialised, so it need not be safe for concurrent use.
+	OnResult func(BulkResult)
+}
+
+// BulkResult is the outcome of one device of a BulkLicense run.
+type BulkResult struct {
+	Config   *LicenseParam
+	TaskID   string
+	Status   LicenseTaskStatus
+	Err      error
+	Duration time.Duration
+}
+
+// BulkSummary aggregates the results of a BulkLicense run. Results are in the
+// order of the configs passed in.
+type BulkSummary struct {
+	Results   []BulkResult
+	Succeeded int
+	Failed    int
+}
+
+// BulkLicense runs the license command of every config (assign or revoke,
+// for managed or unmanaged devices) with at most opts.Concurrency tasks in
+// flight. A failing device does not stop the others. Devices that have not
+// started when ctx is cancelled are reported with ctx's error.
+func (b *BigIQ) BulkLicense(ctx context.Context, configs []*LicenseParam, opts BulkOptions) *BulkSummary {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultBulkConcurrency
+	}
+	summary := &BulkSummary{Results: make([]BulkResult, len(configs))}
+	var mu sync.Mutex
+	report := func(i int, result BulkResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		summary.Results[i] = result
+		if result.Err == nil {
+			summary.Succeeded++
+		} else {
+			summary.Failed++
+		}
+		if opts.OnResult != nil {
+			opts.OnResult(result)
+		}
+	}
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, config := range configs {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			report(i, BulkResult{Config: config, Err: ctx.Err()})
+			continue
+		}
+		wg.Add(1)
+		go func(i int, config *LicenseParam) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			report(i, b.licenseOne(ctx, config))
+		}(i, config)
+	}
+	wg.Wait()
+	return summary
+}
+
+// licenseOne runs a single license task and waits for its final status.
+func (b *BigIQ) licenseOne(ctx context.Context, config *LicenseParam) BulkResult {
+	start := time.Now()
+	result := BulkResult{Config: config}
+	result.TaskID, result.Err = b.PostLicenseContext(ctx, config)
+	if result.Err != nil {
+		result.Duration = time.Since(start)
+		return result
+	}
+	task, err := b.GetLicenseStatusContext(ctx, result.TaskID)
+	result.Duration = time.Since(start)
+	if task != nil {
+		result.Status = task.Status
+	}
+	result.Err = err
+	return result
+}
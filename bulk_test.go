@@ -0,0 +1,109 @@
+package bigiq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBulkLicenseBoundedAndKeepsGoing(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodPost {
+			var config LicenseParam
+			json.NewDecoder(r.Body).Decode(&config)
+			mu.Lock()
+			inFlight++
+			if inFlight > maxInFlight {
+				maxInFlight = inFlight
+			}
+			mu.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+			fmt.Fprintf(w, `{"id":"task-%s"}`, config.Address)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "task-10.0.0.3") {
+			w.Write([]byte(`{"status":"FAILED","errorMessage":"no licenses available"}`))
+			return
+		}
+		w.Write([]byte(`{"status":"FINISHED"}`))
+	}))
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", &ConfigOptions{LicensePollInterval: time.Millisecond})
+
+	var configs []*LicenseParam
+	for i := 1; i <= 6; i++ {
+		configs = append(configs, &LicenseParam{Command: "assign", Address: fmt.Sprintf("10.0.0.%d", i)})
+	}
+	streamed := 0
+	summary := b.BulkLicense(context.Background(), configs, BulkOptions{
+		Concurrency: 2,
+		OnResult:    func(BulkResult) { streamed++ },
+	})
+
+	assert.Equal(t, 6, streamed)
+	assert.Equal(t, 5, summary.Succeeded)
+	assert.Equal(t, 1, summary.Failed)
+	assert.Equal(t, LicenseTaskFailed, summary.Results[2].Status)
+	assert.IsType(t, &LicenseError{}, summary.Results[2].Err)
+	assert.Contains(t, summary.Results[2].Err.Error(), "no licenses available")
+	assert.Equal(t, "task-10.0.0.6", summary.Results[5].TaskID)
+	assert.True(t, maxInFlight <= 2)
+}
+
+func TestGetLicenseStatusGivesUpOnMissingTask(t *testing.T) {
+	defer func(grace time.Duration) { licenseTaskGrace = grace }(licenseTaskGrace)
+	licenseTaskGrace = 20 * time.Millisecond
+	gets := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		gets++
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"code":404,"message":"task not found"}`))
+	}))
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", &ConfigOptions{LicensePollInterval: time.Millisecond})
+
+	task, err := b.GetLicenseStatusContext(context.Background(), "task-1")
+
+	assert.Nil(t, task)
+	assert.Contains(t, err.Error(), "license task task-1 not found")
+	assert.True(t, gets > 1)
+}
+
+func TestBulkLicensePassesContextToTasks(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodPost {
+			w.Write([]byte(`{"id":"task-1"}`))
+			return
+		}
+		w.Write([]byte(`{"status":"STARTED"}`))
+	}))
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", &ConfigOptions{LicensePollInterval: time.Millisecond})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	summary := b.BulkLicense(ctx, []*LicenseParam{{Command: LicenseAssign, Address: "10.0.0.1"}}, BulkOptions{})
+
+	assert.Equal(t, 1, summary.Failed)
+	assert.Equal(t, "task-1", summary.Results[0].TaskID)
+	assert.Equal(t, context.DeadlineExceeded, summary.Results[0].Err)
+
+	_, err := b.PostLicenseContext(ctx, &LicenseParam{Command: LicenseAssign, Address: "10.0.0.2"})
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
@@ -0,0 +1,208 @@
+package bigiq
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultCacheMaxEntries bounds the response cache when no size is configured.
+const defaultCacheMaxEntries = 256
+
+// responseCache holds raw GET responses for the read-heavy lookups (pool,
+// device and offering collections) so that a single workflow does not fetch
+// the same collection over and over. Entries expire after ttl, the least
+// recently used entry is evicted once maxEntries is reached, and concurrent
+// identical GETs share a single request.
+type responseCache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	entries    map[string]*list.Element
+	lru        *list.List
+	inflight   map[string]*cacheCall
+}
+
+type cacheEntry struct {
+	key     string
+	data    []byte
+	expires time.Time
+}
+
+// cacheCall is an in-flight GET that other callers of the same key wait on.
+type cacheCall struct {
+	wg   sync.WaitGroup
+	data []byte
+	err  error
+}
+
+func newResponseCache(ttl time.Duration, maxEntries int) *responseCache {
+	if maxEntries <= 0 {
+		maxEntries = defaultCacheMaxEntries
+	}
+	return &responseCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+		inflight:   make(map[string]*cacheCall),
+	}
+}
+
+// get returns the cached response for key, or runs fetch to populate it. Only
+// successful responses are stored; errors are shared with concurrent waiters
+// but not cached.
+func (c *responseCache) get(key string, fetch func() ([]byte, error)) ([]byte, error) {
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*cacheEntry)
+		if time.Now().Before(entry.expires) {
+			c.lru.MoveToFront(el)
+			c.mu.Unlock()
+			return entry.data, nil
+		}
+		c.removeElement(el)
+	}
+	if call, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		call.wg.Wait()
+		return call.data, call.err
+	}
+	call := &cacheCall{}
+	call.wg.Add(1)
+	c.inflight[key] = call
+	c.mu.Unlock()
+
+	call.data, call.err = fetch()
+
+	c.mu.Lock()
+	// A mutating call may have invalidated this key while the GET was in
+	// flight, in which case the inflight entry is already gone and the
+	// response must not be stored.
+	if c.inflight[key] == call {
+		delete(c.inflight, key)
+		if call.err == nil {
+			c.store(key, call.data)
+		}
+	}
+	c.mu.Unlock()
+	call.wg.Done()
+
+	return call.data, call.err
+}
+
+func (c *responseCache) store(key string, data []byte) {
+	if el, ok := c.entries[key]; ok {
+		c.removeElement(el)
+	}
+	el := c.lru.PushFront(&cacheEntry{key: key, data: data, expires: time.Now().Add(c.ttl)})
+	c.entries[key] = el
+	for c.lru.Len() > c.maxEntries {
+		c.removeElement(c.lru.Back())
+	}
+}
+
+func (c *responseCache) removeElement(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.entries, el.Value.(*cacheEntry).key)
+}
+
+// invalidate drops every entry whose path shares a prefix with path, so a
+// write to a pool member clears the cached pool and member collections and a
+// write to a collection clears the cached items below it.
+func (c *responseCache) invalidate(path string) {
+	path = cacheKey(path)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, el := range c.entries {
+		if pathOverlaps(key, path) {
+			c.removeElement(el)
+		}
+	}
+	for key := range c.inflight {
+		if pathOverlaps(key, path) {
+			delete(c.inflight, key)
+		}
+	}
+}
+
+// managedDevicesPath is the collection GetManagedDevices and GetDeviceId read.
+var managedDevicesPath = strings.Join([]string{uriMgmt, uriShared, uriResolver, uriDevicegroup, uriCmBigIQ, uriDevices}, "/")
+
+// writeInvalidations maps a path segment of a write to the cached
+// collections the write changes besides its own path: device trust, import
+// and removal tasks change the managed devices.
+var writeInvalidations = map[string][]string{
+	uriDeviceTrust:         {managedDevicesPath},
+	uriDeclareMgmt:         {managedDevicesPath},
+	uriRemoveMgmtAuthority: {managedDevicesPath},
+	uriRemoveTrust:         {managedDevicesPath},
+}
+
+// invalidateWrite drops the entries a write to url changes.
+func (c *responseCache) invalidateWrite(url string) {
+	c.invalidate(url)
+	for _, segment := range strings.Split(cacheKey(url), "/") {
+		for _, path := range writeInvalidations[segment] {
+			c.invalidate(path)
+		}
+	}
+}
+
+func (c *responseCache) flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.inflight = make(map[string]*cacheCall)
+}
+
+// cacheKey normalises a request URL to the path used for cache lookups.
+func cacheKey(url string) string {
+	if i := strings.IndexByte(url, '?'); i >= 0 {
+		url = url[:i]
+	}
+	return strings.Trim(url, "/")
+}
+
+func pathOverlaps(a, b string) bool {
+	return a == b || strings.HasPrefix(a, b+"/") || strings.HasPrefix(b, a+"/")
+}
+
+// EnableCache turns on response caching for the read-heavy lookups of this
+// session. Cached responses live for ttl and at most maxEntries are kept; a
+// maxEntries of zero uses a default bound. Calling EnableCache again replaces
+// the existing cache.
+func (b *BigIQ) EnableCache(ttl time.Duration, maxEntries int) {
+	b.cache = newResponseCache(ttl, maxEntries)
+}
+
+// DisableCache turns off response caching and drops all cached responses.
+func (b *BigIQ) DisableCache() {
+	b.cache = nil
+}
+
+// FlushCache drops all cached responses without disabling the cache.
+func (b *BigIQ) FlushCache() {
+	if b.cache != nil {
+		b.cache.flush()
+	}
+}
+
+// getForEntityCached behaves like getForEntity but serves the response from
+// the session cache when one is enabled.
+func (b *BigIQ) getForEntityCached(e interface{}, path ...string) (error, bool) {
+	if b.cache == nil {
+		return b.getForEntity(e, path...)
+	}
+	req := &APIRequest{
+		Method:      "get",
+		URL:         b.iControlPath(path),
+		ContentType: "application/json",
+	}
+	resp, err := b.cache.get(cacheKey(req.URL), func() ([]byte, error) {
+		return b.APICall(req)
+	})
+	return b.decodeEntity(e, resp, err)
+}
@@ -0,0 +1,151 @@
+package bigiq
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const regKeyPoolsResponse = `{"items":[{"id":"pool-id","name":"pool-name"}]}`
+
+func newCacheTestServer(t *testing.T, hits *int32, release <-chan struct{}) (*httptest.Server, *BigIQ) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			atomic.AddInt32(hits, 1)
+			if release != nil {
+				<-release
+			}
+		}
+		w.Write([]byte(regKeyPoolsResponse))
+	}))
+	t.Cleanup(server.Close)
+	return server, NewSession(server.URL, "", "", "", &ConfigOptions{
+		APICallTimeout: 5 * time.Second,
+		CacheTTL:       time.Minute,
+	})
+}
+
+func TestCacheServesRepeatedLookups(t *testing.T) {
+	var hits int32
+	_, b := newCacheTestServer(t, &hits, nil)
+
+	for i := 0; i < 3; i++ {
+		id, err := b.GetRegkeyPoolId("pool-name")
+		assert.Nil(t, err)
+		assert.Equal(t, "pool-id", id)
+	}
+	pool, err := b.GetPoolType("pool-name")
+	assert.Nil(t, err)
+	assert.Equal(t, "pool-id", pool.ID)
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+}
+
+func TestCacheInvalidatedByMutation(t *testing.T) {
+	var hits int32
+	_, b := newCacheTestServer(t, &hits, nil)
+
+	_, err := b.GetRegkeyPoolId("pool-name")
+	assert.Nil(t, err)
+	assert.Nil(t, b.DeleteRegPool("pool-name"))
+	_, err = b.GetRegkeyPoolId("pool-name")
+	assert.Nil(t, err)
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&hits))
+}
+
+func TestCacheCollapsesConcurrentGets(t *testing.T) {
+	var hits int32
+	release := make(chan struct{})
+	_, b := newCacheTestServer(t, &hits, release)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id, err := b.GetRegkeyPoolId("pool-name")
+			assert.Nil(t, err)
+			assert.Equal(t, "pool-id", id)
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+}
+
+func TestCacheExpiryAndEviction(t *testing.T) {
+	c := newResponseCache(time.Minute, 2)
+	fetches := 0
+	fetch := func() ([]byte, error) {
+		fetches++
+		return []byte("{}"), nil
+	}
+
+	c.get("a", fetch)
+	c.get("b", fetch)
+	c.get("a", fetch)
+	c.get("c", fetch) // evicts b, the least recently used
+	c.get("a", fetch)
+	assert.Equal(t, 3, fetches)
+	c.get("b", fetch)
+	assert.Equal(t, 4, fetches)
+
+	c.ttl = 0
+	c.store("d", []byte("{}"))
+	c.get("d", fetch)
+	assert.Equal(t, 5, fetches)
+}
+
+func TestPathOverlaps(t *testing.T) {
+	assert.True(t, pathOverlaps("mgmt/cm/device/licensing/pool/regkey/licenses", "mgmt/cm/device/licensing/pool/regkey/licenses/id"))
+	assert.True(t, pathOverlaps("mgmt/cm/device/licensing/pool/regkey/licenses/id", "mgmt/cm/device/licensing/pool/regkey/licenses"))
+	assert.False(t, pathOverlaps("mgmt/cm/device/licensing/pool/regkey/licenses", "mgmt/cm/device/licensing/pool/regkey/licenses-other"))
+	assert.Equal(t, "mgmt/shared/appsvcs/declare", cacheKey("mgmt/shared/appsvcs/declare?async=true"))
+}
+
+func TestCacheInvalidatedAfterWriteCompletes(t *testing.T) {
+	var hits int32
+	var b *BigIQ
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			atomic.AddInt32(&hits, 1)
+		} else {
+			// A lookup while the delete is being applied caches the old pool.
+			b.GetRegkeyPoolId("pool-name")
+		}
+		w.Write([]byte(regKeyPoolsResponse))
+	}))
+	defer server.Close()
+	b = NewSession(server.URL, "", "", "", &ConfigOptions{APICallTimeout: 5 * time.Second, CacheTTL: time.Minute})
+
+	assert.Nil(t, b.delete(uriMgmt, uriCm, uriDevice, uriLicensing, uriPool, uriRegkey, uriLicenses, "pool-id"))
+	_, err := b.GetRegkeyPoolId("pool-name")
+	assert.Nil(t, err)
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&hits))
+}
+
+func TestDeviceTasksInvalidateManagedDevices(t *testing.T) {
+	cache := newResponseCache(time.Minute, 0)
+	for _, task := range []string{
+		"mgmt/cm/global/tasks/device-trust",
+		"mgmt/cm/adc-core/tasks/declare-mgmt-authority",
+		"mgmt/cm/global/tasks/device-remove-trust/task-1",
+	} {
+		cache.store(managedDevicesPath, []byte(`{}`))
+		cache.store("mgmt/cm/device/licensing/pool/regkey/licenses", []byte(`{}`))
+		cache.invalidateWrite(task)
+		_, cached := cache.entries[managedDevicesPath]
+		assert.False(t, cached, task)
+		_, cached = cache.entries["mgmt/cm/device/licensing/pool/regkey/licenses"]
+		assert.True(t, cached, task)
+	}
+}
@@ -0,0 +1,148 @@
+package bigiq
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// ConflictError is returned by the ReadModifyWrite helpers when the object
+// was changed by someone else between the read and the write, i.e. BIG-IQ
+// rejected the generation or ETag precondition.
+type ConflictError struct {
+	Path       string
+	StatusCode int
+	Message    string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("conflicting update to %s (HTTP %d): %s", e.Path, e.StatusCode, e.Message)
+}
+
+// IsConflict reports whether err is, or wraps, a *ConflictError.
+func IsConflict(err error) bool {
+	var conflict *ConflictError
+	return errors.As(err, &conflict)
+}
+
+// getWithETag reads path into e and returns the response ETag, if any.
+func (b *BigIQ) getWithETag(e interface{}, path ...string) (string, error) {
+	req := &APIRequest{
+		Method:      "get",
+		URL:         b.iControlPath(path),
+		ContentType: "application/json",
+	}
+	data, res, err := b.apiCall(req)
+	if err != nil {
+		return "", err
+	}
+	if err := json.Unmarshal(data, e); err != nil {
+		return "", err
+	}
+	return res.Header.Get("ETag"), nil
+}
+
+// writeIfMatch sends body with an If-Match precondition when etag is set.
+// The body itself carries the generation it was read at. A rejected
+// precondition is reported as a *ConflictError.
+func (b *BigIQ) writeIfMatch(method string, body interface{}, etag string, path ...string) error {
+	marshalJSON, err := jsonMarshal(body)
+	if err != nil {
+		return err
+	}
+	req := &APIRequest{
+		Method:      method,
+		URL:         b.iControlPath(path),
+		Body:        strings.TrimRight(string(marshalJSON), "\n"),
+		ContentType: "application/json",
+	}
+	if etag != "" {
+		req.Headers = map[string]string{"If-Match": etag}
+	}
+	_, res, err := b.apiCall(req)
+	if err != nil && res != nil && isConflictResponse(res.StatusCode, err) {
+		return &ConflictError{Path: req.URL, StatusCode: res.StatusCode, Message: err.Error()}
+	}
+	return err
+}
+
+// isConflictResponse recognises a lost update: 409 and 412 responses, and the
+// 400 BIG-IQ returns when the generation in the body is stale.
+func isConflictResponse(status int, err error) bool {
+	switch status {
+	case http.StatusConflict, http.StatusPreconditionFailed:
+		return true
+	case http.StatusBadRequest:
+		return strings.Contains(strings.ToLower(err.Error()), "generation")
+	}
+	return false
+}
+
+// readModifyWrite reads the object at path into e, lets merge change it and
+// writes it back guarded by the generation and ETag that were read. On a
+// conflict the object is read again and merge re-applied, up to retries
+// times; merge must therefore be safe to call repeatedly on fresh copies.
+func (b *BigIQ) readModifyWrite(method string, e interface{}, merge func() error, retries int, path ...string) error {
+	for attempt := 0; ; attempt++ {
+		v := reflect.ValueOf(e).Elem()
+		v.Set(reflect.Zero(v.Type()))
+		etag, err := b.getWithETag(e, path...)
+		if err != nil {
+			return err
+		}
+		if err := merge(); err != nil {
+			return err
+		}
+		err = b.writeIfMatch(method, e, etag, path...)
+		if err != nil && IsConflict(err) && attempt < retries {
+			b.metrics().IncRetry("read-modify-write")
+			continue
+		}
+		return err
+	}
+}
+
+// ReadModifyWriteVlan reads the named VLAN, applies merge and writes it back
+// only if it has not changed in the meantime. retries is the number of times
+// to re-read and re-apply merge after a conflict; with zero retries a lost
+// update is returned as a *ConflictError.
+func (b *BigIQ) ReadModifyWriteVlan(name string, merge func(*Vlan) error, retries int) error {
+	var vlan Vlan
+	return b.readModifyWrite("put", &vlan, func() error { return merge(&vlan) }, retries, uriNet, uriVlan, name)
+}
+
+// ReadModifyWriteSelfIP is the self IP counterpart of ReadModifyWriteVlan.
+func (b *BigIQ) ReadModifyWriteSelfIP(name string, merge func(*SelfIP) error, retries int) error {
+	var selfIP SelfIP
+	return b.readModifyWrite("put", &selfIP, func() error { return merge(&selfIP) }, retries, uriNet, uriSelf, name)
+}
+
+// ReadModifyWriteRoute is the static route counterpart of ReadModifyWriteVlan.
+func (b *BigIQ) ReadModifyWriteRoute(name string, merge func(*Route) error, retries int) error {
+	var route Route
+	return b.readModifyWrite("put", &route, func() error { return merge(&route) }, retries, uriNet, uriRoute, name)
+}
+
+// ReadModifyWriteDevicegroup is the device group counterpart of
+// ReadModifyWriteVlan.
+func (b *BigIQ) ReadModifyWriteDevicegroup(name string, merge func(*Devicegroup) error, retries int) error {
+	var group Devicegroup
+	return b.readModifyWrite("put", &group, func() error { return merge(&group) }, retries, uriCm, uriDG, name)
+}
+
+// ReadModifyWriteRegPool patches the named regkey pool under the same
+// generation and ETag guard as ReadModifyWriteVlan.
+func (b *BigIQ) ReadModifyWriteRegPool(name string, merge func(*RegPool) error, retries int) error {
+	poolID, err := b.GetRegkeyPoolId(name)
+	if err != nil {
+		return err
+	}
+	if poolID == "" {
+		return fmt.Errorf("regkey pool %s not found", name)
+	}
+	var pool RegPool
+	return b.readModifyWrite("patch", &pool, func() error { return merge(&pool) }, retries, uriMgmt, uriCm, uriDevice, uriLicensing, uriPool, uriRegkey, uriLicenses, poolID)
+}
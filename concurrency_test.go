@@ -0,0 +1,72 @@
+package bigiq
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadModifyWriteRetriesOnConflict(t *testing.T) {
+	generation := 1
+	var ifMatch []string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("ETag", `"gen-`+string(rune('0'+generation))+`"`)
+			json.NewEncoder(w).Encode(Vlan{Name: "vlan-name", Generation: generation, MTU: 1500})
+		case http.MethodPut:
+			ifMatch = append(ifMatch, r.Header.Get("If-Match"))
+			var vlan Vlan
+			json.NewDecoder(r.Body).Decode(&vlan)
+			if vlan.Generation != 2 {
+				// Someone else wrote the VLAN after our first read.
+				generation = 2
+				w.WriteHeader(http.StatusConflict)
+				w.Write([]byte(`{"code":409,"message":"generation mismatch"}`))
+				return
+			}
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+
+	merges := 0
+	err := b.ReadModifyWriteVlan("vlan-name", func(v *Vlan) error {
+		merges++
+		v.MTU = 9000
+		return nil
+	}, 1)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, merges)
+	assert.Equal(t, []string{`"gen-1"`, `"gen-2"`}, ifMatch)
+}
+
+func TestReadModifyWriteReturnsConflict(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodPut {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			w.Write([]byte(`{"code":412,"message":"precondition failed"}`))
+			return
+		}
+		w.Write([]byte(`{"name":"default_route","generation":4}`))
+	}))
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+
+	err := b.ReadModifyWriteRoute("default_route", func(r *Route) error {
+		r.Gateway = "1.1.1.1"
+		return nil
+	}, 0)
+
+	assert.True(t, IsConflict(err))
+	conflict := err.(*ConflictError)
+	assert.Equal(t, http.StatusPreconditionFailed, conflict.StatusCode)
+	assert.Equal(t, "net/route/default_route", conflict.Path)
+}
@@ -12,9 +12,11 @@ package bigiq
 
 import (
 	"encoding/json"
+	"fmt"
+	"time"
 )
 
-//  LIC contains device license for BIG-IP system.
+// LIC contains device license for BIG-IP system.
 type LICs struct {
 	LIC []LIC `json:"items"`
 }
@@ -118,6 +120,7 @@ type Devicegroup struct {
 	SaveOnAutoSync               string
 	NetworkFailover              string
 	IncrementalConfigSyncSizeMax int
+	Generation                   int
 	Deviceb                      []Devicerecord
 }
 type devicegroupDTO struct {
@@ -130,6 +133,7 @@ type devicegroupDTO struct {
 	SaveOnAutoSync               string `json:"saveOnAutoSync,omitempty"`
 	NetworkFailover              string `json:"networkFailover,omitempty"`
 	IncrementalConfigSyncSizeMax int    `json:"incrementalConfigSyncSizeMax,omitempty"`
+	Generation                   int    `json:"generation,omitempty"`
 	Deviceb                      struct {
 		Items []Devicerecord `json:"items,omitempty"`
 	} `json:"devicesReference,omitempty"`
@@ -155,6 +159,7 @@ func (p *Devicegroup) MarshalJSON() ([]byte, error) {
 		SaveOnAutoSync:               p.SaveOnAutoSync,
 		NetworkFailover:              p.NetworkFailover,
 		IncrementalConfigSyncSizeMax: p.IncrementalConfigSyncSizeMax,
+		Generation:                   p.Generation,
 		Deviceb: struct {
 			Items []Devicerecord `json:"items,omitempty"`
 		}{Items: p.Deviceb},
@@ -177,6 +182,7 @@ func (p *Devicegroup) UnmarshalJSON(b []byte) error {
 	p.SaveOnAutoSync = dto.SaveOnAutoSync
 	p.NetworkFailover = dto.NetworkFailover
 	p.IncrementalConfigSyncSizeMax = dto.IncrementalConfigSyncSizeMax
+	p.Generation = dto.Generation
 	p.Deviceb = dto.Deviceb.Items
 
 	return nil
@@ -185,19 +191,18 @@ func (p *Devicegroup) UnmarshalJSON(b []byte) error {
 // https://10.192.74.80/mgmt/cm/device/licensing/pool/purchased-pool/licenses
 // The above command will spit out license uuid and which should be mapped uriUuid
 const (
-	uriMgmt          = "mgmt"
-	uriCm            = "cm"
-	uriDiv           = "device"
-	uriDevices       = "devices"
-	uriDG            = "device-group"
-	uriLins          = "licensing"
-	uriPoo           = "pool"
-	uriPur           = "purchased-pool"
-	uriLicn          = "licenses"
-	uriMemb          = "members"
-	uriUtility       = "utility"
-	uriOfferings     = "offerings"
-	uriF5BIGMSPBT10G = "f37c66e0-a80d-43e8-924b-3bbe9fe96bbe"
+	uriMgmt      = "mgmt"
+	uriCm        = "cm"
+	uriDiv       = "device"
+	uriDevices   = "devices"
+	uriDG        = "device-group"
+	uriLins      = "licensing"
+	uriPoo       = "pool"
+	uriPur       = "purchased-pool"
+	uriLicn      = "licenses"
+	uriMemb      = "members"
+	uriUtility   = "utility"
+	uriOfferings = "offerings"
 )
 
 func (p *LIC) MarshalJSON() ([]byte, error) {
@@ -215,69 +220,257 @@ func (p *LIC) UnmarshalJSON(b []byte) error {
 	return marshal(p, &dto)
 }
 
-func (b *BigIQ) getLicensePool() (*LicensePool, error) {
-	var licensePool LicensePool
-	err, _ := b.getForEntity(&licensePool, uriMgmt, uriCm, uriDiv, uriLins, uriPoo, uriPur, uriLicn)
+// PurchasedPool is a purchased license pool: a pool of licenses for one
+// SKU, activated from a single base registration key.
+type PurchasedPool struct {
+	UUID         string             `json:"uuid"`
+	Name         string             `json:"name,omitempty"`
+	BaseRegKey   string             `json:"baseRegKey,omitempty"`
+	SKU          string             `json:"sku,omitempty"`
+	State        string             `json:"state,omitempty"`
+	LicenseState RegKeyLicenseState `json:"licenseState,omitempty"`
+	// Capacity is the number of devices the pool can license, when BIG-IQ
+	// reports it.
+	Capacity int    `json:"capacity,omitempty"`
+	SelfLink string `json:"selfLink,omitempty"`
+}
+
+type purchasedPools struct {
+	Items []PurchasedPool `json:"items"`
+}
+
+// PurchasedPoolMember is a device licensed from a purchased pool.
+type PurchasedPoolMember struct {
+	ID               string              `json:"id"`
+	DeviceAddress    string              `json:"deviceAddress,omitempty"`
+	DeviceName       string              `json:"deviceName,omitempty"`
+	DeviceMachineID  string              `json:"deviceMachineId,omitempty"`
+	DeviceReference  DeviceRef           `json:"deviceReference,omitempty"`
+	MacAddress       string              `json:"macAddress,omitempty"`
+	LastUpdateMicros int64               `json:"lastUpdateMicros,omitempty"`
+	Status           LicenseMemberStatus `json:"status,omitempty"`
+	Message          string              `json:"message,omitempty"`
+	SelfLink         string              `json:"selfLink,omitempty"`
+}
+
+type purchasedPoolMembers struct {
+	Items []PurchasedPoolMember `json:"items"`
+}
+
+// memberRequest is the body posted to a pool or offering members collection
+// to license either a managed or an unmanaged device.
+type memberRequest struct {
+	DeviceReference *DeviceRef `json:"deviceReference,omitempty"`
+	DeviceAddress   string     `json:"deviceAddress,omitempty"`
+	Username        string     `json:"username,omitempty"`
+	Password        string     `json:"password,omitempty"`
+	HTTPSPort       int        `json:"httpsPort,omitempty"`
+	UnitOfMeasure   string     `json:"unitOfMeasure,omitempty"`
+}
+
+// memberRevoke is the body of a revoke for an unmanaged device, which BIG-IQ
+// needs credentials for to remove the license from the device.
+type memberRevoke struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// newMemberRequest builds the member body for device, which is a
+// ManagedDevice or an UnmanagedDevice.
+func newMemberRequest(device interface{}) (*memberRequest, error) {
+	switch d := device.(type) {
+	case ManagedDevice:
+		return &memberRequest{DeviceReference: &DeviceRef{Link: d.DeviceReference.Link}}, nil
+	case *ManagedDevice:
+		return newMemberRequest(*d)
+	case UnmanagedDevice:
+		return &memberRequest{
+			DeviceAddress: d.DeviceAddress,
+			Username:      d.Username,
+			Password:      d.Password,
+			HTTPSPort:     d.HTTPSPort,
+		}, nil
+	case *UnmanagedDevice:
+		return newMemberRequest(*d)
+	}
+	return nil, fmt.Errorf("unsupported device type %T", device)
+}
+
+// revokeMember deletes the member at path. credentials are sent for
+// unmanaged devices and may be nil for managed ones.
+func (b *BigIQ) revokeMember(id string, credentials *UnmanagedDevice, path ...string) error {
+	var err error
+	if credentials == nil {
+		_, err = b.deleteReq(path...)
+	} else {
+		_, err = b.deleteReqBody(memberRevoke{ID: id, Username: credentials.Username, Password: credentials.Password}, path...)
+	}
+	return err
+}
+
+func purchasedPoolPath(parts ...string) []string {
+	return append([]string{uriMgmt, uriCm, uriDiv, uriLins, uriPoo, uriPur, uriLicn}, parts...)
+}
+
+// PurchasedPools returns all purchased license pools.
+func (b *BigIQ) PurchasedPools() ([]PurchasedPool, error) {
+	var pools purchasedPools
+	err, _ := b.getForEntityCached(&pools, purchasedPoolPath()...)
+	if err != nil {
+		return nil, err
+	}
+	return pools.Items, nil
+}
+
+// PurchasedPool returns the purchased pool with the given UUID or name.
+func (b *BigIQ) PurchasedPool(pool string) (*PurchasedPool, error) {
+	pools, err := b.PurchasedPools()
+	if err != nil {
+		return nil, err
+	}
+	for i := range pools {
+		if pools[i].UUID == pool || pools[i].Name == pool {
+			return &pools[i], nil
+		}
+	}
+	return nil, fmt.Errorf("purchased pool %s not found", pool)
+}
+
+// PurchasedPoolMembers returns the devices licensed from the purchased pool
+// with the given UUID or name.
+func (b *BigIQ) PurchasedPoolMembers(pool string) ([]PurchasedPoolMember, error) {
+	p, err := b.PurchasedPool(pool)
+	if err != nil {
+		return nil, err
+	}
+	var members purchasedPoolMembers
+	err, _ = b.getForEntity(&members, purchasedPoolPath(p.UUID, uriMemb)...)
 	if err != nil {
 		return nil, err
 	}
-	// for loop over all returned license pools to check which one has available licenses
-	// getAvailablePool(member[index_of_array].Uuid)
-	// At the end change return statement to return only the UUID string of the one where license
-	// is available
-	return &licensePool, nil
+	return members.Items, nil
 }
 
-// VirtualAddresses returns a list of virtual addresses.
+// AssignPurchasedPoolLicense licenses device, a ManagedDevice or an
+// UnmanagedDevice, from the purchased pool with the given UUID or name.
+func (b *BigIQ) AssignPurchasedPoolLicense(pool string, device interface{}) (member *PurchasedPoolMember, err error) {
+	start := time.Now()
+	defer func() { b.recordTeem(TeemLicenseAssign, start, err) }()
+	body, err := newMemberRequest(device)
+	if err != nil {
+		return nil, err
+	}
+	p, err := b.PurchasedPool(pool)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := b.postReq(body, purchasedPoolPath(p.UUID, uriMemb)...)
+	if err != nil {
+		return nil, err
+	}
+	member = &PurchasedPoolMember{}
+	if err = json.Unmarshal(resp, member); err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+// RevokePurchasedPoolLicense revokes the license of the device at
+// deviceAddress from the purchased pool with the given UUID or name.
+// credentials are required for unmanaged devices and may be nil for managed
+// ones.
+func (b *BigIQ) RevokePurchasedPoolLicense(pool, deviceAddress string, credentials *UnmanagedDevice) (err error) {
+	start := time.Now()
+	defer func() { b.recordTeem(TeemLicenseRevoke, start, err) }()
+	p, err := b.PurchasedPool(pool)
+	if err != nil {
+		return err
+	}
+	var members purchasedPoolMembers
+	err, _ = b.getForEntity(&members, purchasedPoolPath(p.UUID, uriMemb)...)
+	if err != nil {
+		return err
+	}
+	for _, m := range members.Items {
+		if m.DeviceAddress == deviceAddress {
+			return b.revokeMember(m.ID, credentials, purchasedPoolPath(p.UUID, uriMemb, m.ID)...)
+		}
+	}
+	return fmt.Errorf("device %s is not licensed from purchased pool %s", deviceAddress, p.Name)
+}
+
+// firstPurchasedPool returns the first purchased pool, which the LIC helpers
+// operate on.
+func (b *BigIQ) firstPurchasedPool() (*PurchasedPool, error) {
+	pools, err := b.PurchasedPools()
+	if err != nil {
+		return nil, err
+	}
+	if len(pools) == 0 {
+		return nil, fmt.Errorf("no purchased pools found")
+	}
+	return &pools[0], nil
+}
+
+// LIC returns the members of the first purchased pool.
+//
+// Deprecated: use PurchasedPoolMembers.
 func (b *BigIQ) LIC() (*LIC, error) {
 	var va LIC
-	licensePool, licensePoolErr := b.getLicensePool()
-	if licensePoolErr != nil {
-		return nil, licensePoolErr
+	pool, err := b.firstPurchasedPool()
+	if err != nil {
+		return nil, err
 	}
-	err, _ := b.getForEntity(&va, uriMgmt, uriCm, uriDiv, uriLins, uriPoo, uriPur, uriLicn, licensePool.Items[0].Uuid, uriMemb)
+	err, _ = b.getForEntity(&va, purchasedPoolPath(pool.UUID, uriMemb)...)
 	if err != nil {
 		return nil, err
 	}
 	return &va, nil
 }
 
+// CreateLIC licenses an unmanaged device from the first purchased pool.
+//
+// Deprecated: use AssignPurchasedPoolLicense.
 func (b *BigIQ) CreateLIC(deviceAddress string, username string, password string) error {
-	config := &LIC{
+	pool, err := b.firstPurchasedPool()
+	if err != nil {
+		return err
+	}
+	device := UnmanagedDevice{
 		DeviceAddress: deviceAddress,
 		Username:      username,
 		Password:      password,
 	}
-
-	licensePool, licensePoolErr := b.getLicensePool()
-	if licensePoolErr != nil {
-		return licensePoolErr
-	}
-
-	return b.post(config, uriMgmt, uriCm, uriDiv, uriLins, uriPoo, uriPur, uriLicn, licensePool.Items[0].Uuid, uriMemb)
+	_, err = b.AssignPurchasedPoolLicense(pool.UUID, device)
+	return err
 }
 
+// ModifyLIC always fails: purchased pool members cannot be changed in place.
+// Revoke the license with RevokePurchasedPoolLicense and assign a new one with
+// AssignPurchasedPoolLicense instead.
+//
+// Deprecated: use RevokePurchasedPoolLicense and AssignPurchasedPoolLicense.
 func (b *BigIQ) ModifyLIC(config *LIC) error {
-	licensePool, licensePoolErr := b.getLicensePool()
-	if licensePoolErr != nil {
-		return licensePoolErr
-	}
-	return b.post(config, uriMgmt, uriCm, uriDiv, uriLins, uriPoo, uriPur, uriLicn, licensePool.Items[0].Uuid, uriMemb)
+	return fmt.Errorf("purchased pool license of %s cannot be modified in place; use RevokePurchasedPoolLicense and AssignPurchasedPoolLicense", config.DeviceAddress)
 }
 
-func (b *BigIQ) LICs() (*LIC, error) {
-	var members LIC
-	licensePool, licensePoolErr := b.getLicensePool()
-	if licensePoolErr != nil {
-		return nil, licensePoolErr
-	}
-	err, _ := b.getForEntity(&members, uriMgmt, uriCm, uriDiv, uriLins, uriPoo, uriPur, uriLicn, licensePool.Items[0].Uuid, uriMemb)
-
+// LICs returns the devices licensed from all purchased pools.
+func (b *BigIQ) LICs() ([]PurchasedPoolMember, error) {
+	pools, err := b.PurchasedPools()
 	if err != nil {
 		return nil, err
 	}
-
-	return &members, nil
+	var members []PurchasedPoolMember
+	for _, pool := range pools {
+		var poolMembers purchasedPoolMembers
+		err, _ := b.getForEntity(&poolMembers, purchasedPoolPath(pool.UUID, uriMemb)...)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, poolMembers.Items...)
+	}
+	return members, nil
 }
 
 func (b *BigIQ) CreateDevice(name, configsyncIp, mirrorIp, mirrorSecondaryIp string) error {
@@ -0,0 +1,144 @@
+package bigiq
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// purchasedPoolServer serves two purchased pools with one member each and
+// records the requests and bodies it receives.
+func purchasedPoolServer(requests *[]string, bodies map[string][]byte) *httptest.Server {
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		request := r.Method + " " + r.URL.Path
+		*requests = append(*requests, request)
+		var body json.RawMessage
+		if json.NewDecoder(r.Body).Decode(&body) == nil {
+			bodies[request] = body
+		}
+		switch {
+		case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/purchased-pool/licenses"):
+			w.Write([]byte(`{"items":[{"uuid":"p1","name":"pool-a"},{"uuid":"p2","name":"pool-b"}]}`))
+		case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/p1/members"):
+			w.Write([]byte(`{"items":[{"id":"m1","deviceAddress":"10.0.0.1"}]}`))
+		case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/p2/members"):
+			w.Write([]byte(`{"items":[{"id":"m2","deviceAddress":"10.0.0.2"}]}`))
+		default:
+			w.Write([]byte(`{"id":"m3","deviceAddress":"10.0.0.3","status":"INSTALLING"}`))
+		}
+	}))
+}
+
+func TestPurchasedPools(t *testing.T) {
+	var requests []string
+	server := purchasedPoolServer(&requests, map[string][]byte{})
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+
+	pools, err := b.PurchasedPools()
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"p1", "p2"}, []string{pools[0].UUID, pools[1].UUID})
+	assert.Equal(t, []string{"GET /mgmt/cm/device/licensing/pool/purchased-pool/licenses"}, requests)
+}
+
+func TestAssignPurchasedPoolLicense(t *testing.T) {
+	var requests []string
+	bodies := make(map[string][]byte)
+	server := purchasedPoolServer(&requests, bodies)
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+
+	member, err := b.AssignPurchasedPoolLicense("pool-b", UnmanagedDevice{DeviceAddress: "10.0.0.3", Username: "admin", Password: "secret"})
+	assert.Nil(t, err)
+	assert.Equal(t, "m3", member.ID)
+	post := "POST /mgmt/cm/device/licensing/pool/purchased-pool/licenses/p2/members"
+	assert.Contains(t, requests, post)
+	assert.JSONEq(t, `{"deviceAddress":"10.0.0.3","username":"admin","password":"secret"}`, string(bodies[post]))
+
+	_, err = b.AssignPurchasedPoolLicense("p1", ManagedDevice{DeviceReference: DeviceRef{Link: "https://localhost/mgmt/cm/system/machineid-resolver/abc"}})
+	assert.Nil(t, err)
+	post = "POST /mgmt/cm/device/licensing/pool/purchased-pool/licenses/p1/members"
+	assert.JSONEq(t, `{"deviceReference":{"link":"https://localhost/mgmt/cm/system/machineid-resolver/abc"}}`, string(bodies[post]))
+}
+
+func TestRevokePurchasedPoolLicense(t *testing.T) {
+	var requests []string
+	bodies := make(map[string][]byte)
+	server := purchasedPoolServer(&requests, bodies)
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+
+	err := b.RevokePurchasedPoolLicense("pool-b", "10.0.0.2", &UnmanagedDevice{Username: "admin", Password: "secret"})
+	assert.Nil(t, err)
+	del := "DELETE /mgmt/cm/device/licensing/pool/purchased-pool/licenses/p2/members/m2"
+	assert.Contains(t, requests, del)
+	assert.JSONEq(t, `{"id":"m2","username":"admin","password":"secret"}`, string(bodies[del]))
+
+	err = b.RevokePurchasedPoolLicense("pool-b", "10.0.0.9", nil)
+	assert.Contains(t, err.Error(), "not licensed from purchased pool pool-b")
+}
+
+func TestModifyLICFails(t *testing.T) {
+	var requests []string
+	server := purchasedPoolServer(&requests, map[string][]byte{})
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+
+	err := b.ModifyLIC(&LIC{DeviceAddress: "10.0.0.1"})
+
+	assert.Contains(t, err.Error(), "RevokePurchasedPoolLicense")
+	assert.Empty(t, requests)
+}
+
+func TestLICsListsMembersOfAllPurchasedPools(t *testing.T) {
+	var requests []string
+	server := purchasedPoolServer(&requests, map[string][]byte{})
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+
+	members, err := b.LICs()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(members))
+	assert.Equal(t, "10.0.0.1", members[0].DeviceAddress)
+	assert.Equal(t, "10.0.0.2", members[1].DeviceAddress)
+	assert.Contains(t, requests, "GET /mgmt/cm/device/licensing/pool/purchased-pool/licenses/p2/members")
+}
+
+func TestPurchasedPoolLicenseOperationsRecordTeem(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/purchased-pool/licenses"):
+			w.Write([]byte(`{"items":[{"uuid":"p1","name":"pool-a"}]}`))
+		case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/p1/members"):
+			w.Write([]byte(`{"items":[{"id":"m1","deviceAddress":"10.0.0.1"}]}`))
+		default:
+			w.Write([]byte(`{"id":"m1","deviceAddress":"10.0.0.1"}`))
+		}
+	}))
+	defer server.Close()
+	var out bytes.Buffer
+	b := NewSession(server.URL, "", "", "", nil)
+	b.Teem = true
+	b.TeemSink = NewWriterTeemSink(&out)
+
+	_, err := b.AssignPurchasedPoolLicense("pool-a", UnmanagedDevice{DeviceAddress: "10.0.0.1"})
+	assert.Nil(t, err)
+	assert.Nil(t, b.RevokePurchasedPoolLicense("pool-a", "10.0.0.1", nil))
+	_, err = b.AssignPurchasedPoolLicense("pool-x", UnmanagedDevice{DeviceAddress: "10.0.0.1"})
+	assert.NotNil(t, err)
+	b.teem.lookups.Wait()
+
+	records := readTeemRecords(t, &out)
+	assert.Equal(t, 3, len(records))
+	assert.Equal(t, []string{TeemLicenseAssign, TeemLicenseRevoke, TeemLicenseAssign}, []string{records[0].Operation, records[1].Operation, records[2].Operation})
+	assert.Equal(t, []bool{true, true, false}, []bool{records[0].Success, records[1].Success, records[2].Success})
+}
@@ -11,7 +11,7 @@ func main() {
 	f5, _ := bigiq.NewTokenSession("10.0.90.254", "443", "admin", "SuperSecret", "tmos", nil)
 
 	// Licensing Initial Activation API - 1. Start activation of a license (Automatic)
-	//response, err := f5.InitialActivation("xxxxx-xxxxx-xxxxx-xxxxx-xxxxx", "this-is-auto", "ACTIVATING_AUTOMATIC")
+	//response, err := f5.InitialActivation("xxxxx-xxxxx-xxxxx-xxxxx-xxxxx", "this-is-auto", bigiq.ActivationAutomatic)
 	//if err != nil {
 	//	fmt.Println(err)
 	//	return
@@ -19,13 +19,26 @@ func main() {
 	//fmt.Println(response)
 
 	// Licensing Initial Activation API - 1. Start activation of a license (Manual)
-	//response, err := f5.InitialActivation("xxxxx-xxxxx-xxxxx-xxxxx-xxxxx", "this, this is manual", "ACTIVATING_MANUAL")
+	//response, err := f5.InitialActivation("xxxxx-xxxxx-xxxxx-xxxxx-xxxxx", "this, this is manual", bigiq.ActivationManual)
 	//if err != nil {
 	//	fmt.Println(err)
 	//	return
 	//}
 	//fmt.Println(response)
 
+	// Licensing Initial Activation API - 1-3. Start, poll, accept EULA and retry in one call
+	//activation, err := f5.ActivateRegKey(context.Background(), bigiq.ActivationOptions{
+	//	RegKey:           "xxxxx-xxxxx-xxxxx-xxxxx-xxxxx",
+	//	Name:             "this-is-auto",
+	//	MaxRetries:       2,
+	//	CleanupOnFailure: true,
+	//})
+	//if err != nil {
+	//	fmt.Println(err)
+	//	return
+	//}
+	//fmt.Println(activation.Status)
+
 	// Licensing Initial Activation API - 2. Poll to get status
 	fmt.Println(f5.PollActivation("xxxxx-xxxxx-xxxxx-xxxxx-xxxxx"))
 	// TODO: does this need json marshalling for output?
@@ -43,11 +56,19 @@ func main() {
 	//fmt.Print(f5.AcceptEULA("xxxxx-xxxxx-xxxxx-xxxxx-xxxxx"))
 
 	// Licensing Initial Activation API - 4. Complete manual activation by providing license text
-	// TODO: magic, all the magic!  PostReqBody
-	//fmt.Print("DO MAGIC!!!!"))
+	//_, err := f5.StartManualActivation("xxxxx-xxxxx-xxxxx-xxxxx-xxxxx", "this, this is manual")
+	//if err == nil {
+	//	err = f5.SaveDossier(context.Background(), "xxxxx-xxxxx-xxxxx-xxxxx-xxxxx", "dossier.txt")
+	//}
+	// ... submit dossier.txt at https://activate.f5.com and save the license text, then
+	//err = f5.CompleteManualActivationFromFile(context.Background(), "xxxxx-xxxxx-xxxxx-xxxxx-xxxxx", "license.txt")
+	//if err != nil {
+	//	fmt.Println(err)
+	//	return
+	//}
 
 	//Licensing Initial Activation API - 5. Retry Failed Activation
-	//response, err := f5.RemoveActivation("xxxxx-xxxxx-xxxxx-xxxxx-xxxxx")
+	//response, err := f5.RetryActivation("xxxxx-xxxxx-xxxxx-xxxxx-xxxxx")
 	//if err != nil {
 	//	fmt.Println(err)
 	//	return
@@ -0,0 +1,149 @@
+package bigiq
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// PoolTypeBigIQ marks the BIG-IQ's own license in an ExpiringLicense.
+const PoolTypeBigIQ = "bigiq"
+
+// Severities reported by CheckLicenseExpiry, in increasing order.
+const (
+	SeverityOK       = "ok"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+	SeverityExpired  = "expired"
+)
+
+var severityRank = map[string]int{SeverityOK: 0, SeverityWarning: 1, SeverityCritical: 2, SeverityExpired: 3}
+
+// ExpiringLicense is a license, or the BIG-IQ's own license, that ends within
+// the requested window.
+type ExpiringLicense struct {
+	PoolType      string    `json:"poolType"`
+	Pool          string    `json:"pool"`
+	Offering      string    `json:"offering,omitempty"`
+	Expires       time.Time `json:"expires"`
+	DaysRemaining int       `json:"daysRemaining"`
+	Devices       []string  `json:"devices"`
+	Severity      string    `json:"severity,omitempty"`
+}
+
+// ExpiryThresholds sets how close to expiry a license has to be to raise a
+// warning or to be critical. Expired licenses are always reported.
+type ExpiryThresholds struct {
+	Warning  time.Duration
+	Critical time.Duration
+}
+
+// ExpiryError is returned by CheckLicenseExpiry when a threshold is crossed.
+type ExpiryError struct {
+	Severity string
+	Licenses []ExpiringLicense
+}
+
+func (e *ExpiryError) Error() string {
+	first := e.Licenses[0]
+	return fmt.Sprintf("%s: %d license(s) expiring, first %s %s %s in %d days",
+		e.Severity, len(e.Licenses), first.PoolType, first.Pool, first.Offering, first.DaysRemaining)
+}
+
+// parseLicenseDate parses the license dates BIG-IQ reports.
+func parseLicenseDate(value string) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02", "2006/01/02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func daysRemaining(expires, now time.Time) int {
+	return int(math.Floor(expires.Sub(now).Hours() / 24))
+}
+
+// ExpiringLicenses returns every regkey, purchased pool and utility license,
+// and the BIG-IQ's own license, that expires within the given window from
+// now, soonest first. Licenses that have already expired are included.
+func (b *BigIQ) ExpiringLicenses(within time.Duration) ([]ExpiringLicense, error) {
+	inventory, err := b.LicenseInventory()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	deadline := now.Add(within)
+	var expiring []ExpiringLicense
+	for _, e := range inventory.Entries {
+		expires, ok := parseLicenseDate(e.Expires)
+		if !ok || expires.After(deadline) {
+			continue
+		}
+		expiring = append(expiring, ExpiringLicense{
+			PoolType:      e.PoolType,
+			Pool:          e.Pool,
+			Offering:      e.Offering,
+			Expires:       expires,
+			DaysRemaining: daysRemaining(expires, now),
+			Devices:       e.Devices,
+		})
+	}
+
+	var registration BigIQLicenseSummary
+	err, ok := b.getForEntity(&registration, uriShared, uriLicensing, uriRegistration)
+	if err != nil {
+		return nil, err
+	}
+	if expires, found := registration.Expires(); ok && found && !expires.After(deadline) {
+		expiring = append(expiring, ExpiringLicense{
+			PoolType:      PoolTypeBigIQ,
+			Pool:          b.Host,
+			Offering:      registration.RegistrationKey,
+			Expires:       expires,
+			DaysRemaining: daysRemaining(expires, now),
+			Devices:       []string{},
+		})
+	}
+	sort.SliceStable(expiring, func(i, j int) bool { return expiring[i].Expires.Before(expiring[j].Expires) })
+	return expiring, nil
+}
+
+// CheckLicenseExpiry classifies every license expiring within
+// thresholds.Warning and returns the overall severity with the licenses that
+// caused it. When the severity is not SeverityOK the error is an
+// *ExpiryError, so that callers can alert on err != nil alone.
+func (b *BigIQ) CheckLicenseExpiry(thresholds ExpiryThresholds) (string, []ExpiringLicense, error) {
+	window := thresholds.Warning
+	if thresholds.Critical > window {
+		window = thresholds.Critical
+	}
+	expiring, err := b.ExpiringLicenses(window)
+	if err != nil {
+		return "", nil, err
+	}
+	now := time.Now()
+	severity := SeverityOK
+	for i := range expiring {
+		remaining := expiring[i].Expires.Sub(now)
+		switch {
+		case remaining <= 0:
+			expiring[i].Severity = SeverityExpired
+		case remaining <= thresholds.Critical:
+			expiring[i].Severity = SeverityCritical
+		default:
+			expiring[i].Severity = SeverityWarning
+		}
+		if severityRank[expiring[i].Severity] > severityRank[severity] {
+			severity = expiring[i].Severity
+		}
+	}
+	if severity == SeverityOK {
+		return severity, expiring, nil
+	}
+	return severity, expiring, &ExpiryError{Severity: severity, Licenses: expiring}
+}
@@ -0,0 +1,47 @@
+package bigiq
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckLicenseExpiry(t *testing.T) {
+	soon := time.Now().Add(3 * 24 * time.Hour).UTC().Format(time.RFC3339)
+	later := time.Now().Add(20 * 24 * time.Hour).UTC().Format(time.RFC3339)
+	never := time.Now().Add(400 * 24 * time.Hour).UTC().Format(time.RFC3339)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		path := r.URL.Path
+		switch {
+		case strings.HasSuffix(path, "/shared/licensing/registration"):
+			fmt.Fprintf(w, `{"registrationKey":"BIGIQ-KEY","licenseEndDateTime":%q}`, later)
+		case strings.HasSuffix(path, "/purchased-pool/licenses"):
+			fmt.Fprintf(w, `{"items":[{"uuid":"pp-1","name":"pp","licenseState":{"licenseEndDateTime":%q}},
+				{"uuid":"pp-2","name":"pp-long","licenseState":{"licenseEndDateTime":%q}}]}`, soon, never)
+		case strings.HasSuffix(path, "/pp-1/members"):
+			w.Write([]byte(`{"items":[{"id":"m1","deviceName":"bigip1"}]}`))
+		default:
+			w.Write([]byte(`{"items":[]}`))
+		}
+	}))
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+
+	severity, licenses, err := b.CheckLicenseExpiry(ExpiryThresholds{Warning: 30 * 24 * time.Hour, Critical: 7 * 24 * time.Hour})
+
+	assert.Equal(t, SeverityCritical, severity)
+	assert.IsType(t, &ExpiryError{}, err)
+	assert.Len(t, licenses, 2)
+	assert.Equal(t, "pp", licenses[0].Pool)
+	assert.Equal(t, 2, licenses[0].DaysRemaining)
+	assert.Equal(t, []string{"bigip1"}, licenses[0].Devices)
+	assert.Equal(t, SeverityCritical, licenses[0].Severity)
+	assert.Equal(t, PoolTypeBigIQ, licenses[1].PoolType)
+	assert.Equal(t, SeverityWarning, licenses[1].Severity)
+}
@@ -0,0 +1,213 @@
+package bigiq
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// licenseTaskPageSize is the number of tasks LicenseTasks requests at a time.
+const licenseTaskPageSize = 100
+
+// LicenseHistoryFilter selects entries of LicenseHistory. Zero fields match
+// everything.
+type LicenseHistoryFilter struct {
+	// Since and Until bound the start time of the task.
+	Since time.Time
+	Until time.Time
+	// Device matches the device address or MAC address, case-insensitively.
+	Device string
+	// Pool matches the license pool name.
+	Pool    string
+	Command LicenseCommand
+	Status  LicenseTaskStatus
+}
+
+// LicenseHistoryEntry is one assign or revoke task of a license pool.
+type LicenseHistoryEntry struct {
+	TaskID         string            `json:"taskId"`
+	Command        string            `json:"command"`
+	Status         LicenseTaskStatus `json:"status"`
+	PoolType       string            `json:"poolType,omitempty"`
+	Pool           string            `json:"pool"`
+	RegKey         string            `json:"regKey,omitempty"`
+	DeviceAddress  string            `json:"deviceAddress"`
+	MacAddress     string            `json:"macAddress,omitempty"`
+	AssignmentType string            `json:"assignmentType,omitempty"`
+	UnitOfMeasure  string            `json:"unitOfMeasure,omitempty"`
+	// User is the BIG-IQ user who submitted the task.
+	User  string    `json:"user,omitempty"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end,omitempty"`
+	Error string    `json:"error,omitempty"`
+}
+
+// LicenseHistory is the assignment and revocation history of the license
+// pools, oldest first.
+type LicenseHistory struct {
+	Entries []LicenseHistoryEntry `json:"entries"`
+}
+
+var historyColumns = []string{"START", "END", "COMMAND", "STATUS", "POOL TYPE", "POOL", "REGKEY", "DEVICE", "MAC", "ASSIGNMENT TYPE", "UNIT OF MEASURE", "USER", "TASK", "ERROR"}
+
+// LicenseTasks returns the member-management license tasks BIG-IQ still
+// keeps, across regkey, purchased and utility pools, one page at a time.
+func (b *BigIQ) LicenseTasks() ([]LicenseTask, error) {
+	var all []LicenseTask
+	for skip := 0; ; skip += licenseTaskPageSize {
+		var page struct {
+			Items    []LicenseTask `json:"items"`
+			NextLink string        `json:"nextLink,omitempty"`
+		}
+		query := fmt.Sprintf("%s?$top=%d&$skip=%d", uriManagement, licenseTaskPageSize, skip)
+		err, _ := b.getForEntity(&page, uriMgmt, uriCm, uriDevice, uriTasks, uriLicensing, uriPool, query)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, page.Items...)
+		if page.NextLink == "" || len(page.Items) == 0 {
+			return all, nil
+		}
+	}
+}
+
+// LicenseHistory returns who assigned or revoked which license to which
+// device and when, from the license tasks matching filter. How far back it
+// goes depends on how long BIG-IQ retains finished tasks.
+func (b *BigIQ) LicenseHistory(filter LicenseHistoryFilter) (*LicenseHistory, error) {
+	tasks, err := b.LicenseTasks()
+	if err != nil {
+		return nil, err
+	}
+	history := &LicenseHistory{Entries: []LicenseHistoryEntry{}}
+	users := make(map[string]string)
+	for _, task := range tasks {
+		entry := newLicenseHistoryEntry(task)
+		if !filter.matches(entry) {
+			continue
+		}
+		if link := task.UserReference.Link; link != "" {
+			if _, ok := users[link]; !ok {
+				users[link] = b.userName(link)
+			}
+			entry.User = users[link]
+		}
+		history.Entries = append(history.Entries, entry)
+	}
+	sort.SliceStable(history.Entries, func(i, j int) bool {
+		return history.Entries[i].Start.Before(history.Entries[j].Start)
+	})
+	return history, nil
+}
+
+func newLicenseHistoryEntry(task LicenseTask) LicenseHistoryEntry {
+	entry := LicenseHistoryEntry{
+		TaskID:         task.ID,
+		Command:        task.Command,
+		Status:         task.Status,
+		Pool:           task.LicensePoolName,
+		DeviceAddress:  task.Address,
+		MacAddress:     task.MacAddress,
+		AssignmentType: task.AssignmentType,
+		UnitOfMeasure:  task.UnitOfMeasure,
+		Error:          task.ErrorMessage,
+	}
+	entry.Start, _ = parseLicenseDate(task.StartDateTime)
+	entry.End, _ = parseLicenseDate(task.EndDateTime)
+	// The assignment link tells the pool type and, for regkey pools, the key:
+	// .../regkey/licenses/<pool>/offerings/<regkey>/members/<member>.
+	link := task.LicenseAssignmentReference.Link
+	switch {
+	case strings.Contains(link, "/"+uriRegkey+"/"):
+		entry.PoolType = PoolTypeRegKey
+		entry.RegKey = linkSegmentAfter(link, uriOfferings)
+	case strings.Contains(link, "/"+uriPur+"/"):
+		entry.PoolType = PoolTypePurchased
+	case strings.Contains(link, "/"+uriUtility+"/") || task.UnitOfMeasure != "":
+		entry.PoolType = PoolTypeUtility
+	}
+	return entry
+}
+
+// userName returns the name of the BIG-IQ user at link, the userReference of
+// the task. It falls back to the last segment of the link, which is the name
+// of a local user, if the user cannot be looked up.
+func (b *BigIQ) userName(link string) string {
+	var user struct {
+		Name string `json:"name"`
+	}
+	path := linkPath(link)
+	err, ok := b.getForEntity(&user, path...)
+	if err != nil {
+		log.Printf("[WARN] looking up license task user %s: %v", link, err)
+	}
+	if err != nil || !ok || user.Name == "" {
+		return path[len(path)-1]
+	}
+	return user.Name
+}
+
+// linkSegmentAfter returns the path segment of link that follows name.
+func linkSegmentAfter(link, name string) string {
+	parts := strings.Split(link, "/")
+	for i := 0; i < len(parts)-1; i++ {
+		if parts[i] == name {
+			return parts[i+1]
+		}
+	}
+	return ""
+}
+
+func (f LicenseHistoryFilter) matches(e LicenseHistoryEntry) bool {
+	switch {
+	case !f.Since.IsZero() && e.Start.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && e.Start.After(f.Until):
+		return false
+	case f.Pool != "" && e.Pool != f.Pool:
+		return false
+	case f.Command != "" && !strings.EqualFold(e.Command, string(f.Command)):
+		return false
+	case f.Status != "" && e.Status != f.Status:
+		return false
+	case f.Device != "" && !strings.EqualFold(e.DeviceAddress, f.Device) && !strings.EqualFold(e.MacAddress, f.Device):
+		return false
+	}
+	return true
+}
+
+func (e LicenseHistoryEntry) row() []string {
+	end := ""
+	if !e.End.IsZero() {
+		end = e.End.Format(time.RFC3339)
+	}
+	return []string{e.Start.Format(time.RFC3339), end, e.Command, string(e.Status), e.PoolType, e.Pool, e.RegKey,
+		e.DeviceAddress, e.MacAddress, e.AssignmentType, e.UnitOfMeasure, e.User, e.TaskID, e.Error}
+}
+
+// WriteJSON writes the history to w as indented JSON.
+func (h *LicenseHistory) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(h)
+}
+
+// WriteCSV writes one row per task to w, with a header row.
+func (h *LicenseHistory) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(historyColumns); err != nil {
+		return err
+	}
+	for _, e := range h.Entries {
+		if err := cw.Write(e.row()); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,85 @@
+package bigiq
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLicenseHistory(t *testing.T) {
+	var skips, users []string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.Contains(r.URL.Path, "/authz/users/") {
+			users = append(users, r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:])
+		}
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/authz/users/carol"):
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"code":403,"message":"forbidden"}`))
+			return
+		case strings.HasSuffix(r.URL.Path, "/authz/users/u-1"):
+			w.Write([]byte(`{"name":"alice"}`))
+			return
+		case strings.Contains(r.URL.Path, "/authz/users/"):
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"code":404,"message":"user not found"}`))
+			return
+		}
+		assert.True(t, strings.HasSuffix(r.URL.Path, "/tasks/licensing/pool/member-management"))
+		assert.Equal(t, "100", r.URL.Query().Get("$top"))
+		skips = append(skips, r.URL.Query().Get("$skip"))
+		if r.URL.Query().Get("$skip") == "100" {
+			w.Write([]byte(`{"items":[
+				{"id":"t2","status":"FAILED","command":"assign","address":"10.0.0.2","licensePoolName":"utility","unitOfMeasure":"hourly",
+				 "userReference":{"link":"https://localhost/mgmt/shared/authz/users/carol"},
+				 "startDateTime":"2026-02-01T10:00:00.000-07:00","errorMessage":"no capacity"}]}`))
+			return
+		}
+		w.Write([]byte(`{"nextLink":"https://localhost/mgmt/cm/device/tasks/licensing/pool/member-management?$top=100&$skip=100","items":[
+			{"id":"t3","status":"FINISHED","command":"revoke","address":"10.0.0.1","licensePoolName":"regpool","username":"admin",
+			 "userReference":{"link":"https://localhost/mgmt/shared/authz/users/u-1"},
+			 "startDateTime":"2026-03-01T10:00:00.000-07:00","licenseAssignmentReference":{"link":"https://localhost/mgmt/cm/device/licensing/pool/regkey/licenses/p1/offerings/AAAAA-BBBBB/members/m1"}},
+			{"id":"t1","status":"FINISHED","command":"assign","address":"10.0.0.1","licensePoolName":"regpool","username":"admin",
+			 "userReference":{"link":"https://localhost/mgmt/shared/authz/users/bob"},
+			 "startDateTime":"2026-01-01T10:00:00.000-07:00","endDateTime":"2026-01-01T10:01:00.000-07:00",
+			 "licenseAssignmentReference":{"link":"https://localhost/mgmt/cm/device/licensing/pool/regkey/licenses/p1/offerings/AAAAA-BBBBB/members/m1"}}]}`))
+	}))
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+
+	history, err := b.LicenseHistory(LicenseHistoryFilter{Device: "10.0.0.1"})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(history.Entries))
+	assert.Equal(t, "t1", history.Entries[0].TaskID)
+	assert.Equal(t, PoolTypeRegKey, history.Entries[0].PoolType)
+	assert.Equal(t, "AAAAA-BBBBB", history.Entries[0].RegKey)
+	// bob no longer exists; admin is the device credential, not the user.
+	assert.Equal(t, "bob", history.Entries[0].User)
+	assert.Equal(t, "alice", history.Entries[1].User)
+	assert.Equal(t, []string{"0", "100"}, skips)
+	// Only the users of matching tasks are looked up.
+	assert.Equal(t, []string{"u-1", "bob"}, users)
+
+	history, err = b.LicenseHistory(LicenseHistoryFilter{
+		Since: time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC),
+		Until: time.Date(2026, 2, 15, 0, 0, 0, 0, time.UTC),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(history.Entries))
+	assert.Equal(t, PoolTypeUtility, history.Entries[0].PoolType)
+	// carol cannot be looked up.
+	assert.Equal(t, "carol", history.Entries[0].User)
+
+	var buf bytes.Buffer
+	assert.Nil(t, history.WriteCSV(&buf))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, 2, len(lines))
+	assert.Contains(t, lines[1], "assign,FAILED,utility,utility,,10.0.0.2")
+	assert.Contains(t, lines[1], "no capacity")
+}
@@ -0,0 +1,299 @@
+package bigiq
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Pool types reported in an InventoryEntry.
+const (
+	PoolTypeRegKey    = "regkey"
+	PoolTypePurchased = "purchased"
+	PoolTypeUtility   = "utility"
+)
+
+// InventoryEntry is the capacity of one pool or offering. Total is zero when
+// BIG-IQ does not report the capacity, in which case Free is zero as well.
+type InventoryEntry struct {
+	PoolType string   `json:"poolType"`
+	Pool     string   `json:"pool"`
+	Offering string   `json:"offering,omitempty"`
+	SKU      string   `json:"sku,omitempty"`
+	Status   string   `json:"status,omitempty"`
+	Total    int      `json:"total"`
+	Used     int      `json:"used"`
+	Free     int      `json:"free"`
+	Expires  string   `json:"expires,omitempty"`
+	Devices  []string `json:"devices"`
+}
+
+// Inventory is the license capacity of a BIG-IQ across all pool types.
+type Inventory struct {
+	Entries []InventoryEntry `json:"entries"`
+}
+
+var inventoryColumns = []string{"POOL TYPE", "POOL", "OFFERING", "SKU", "STATUS", "TOTAL", "USED", "FREE", "EXPIRES", "DEVICES"}
+
+func newInventoryEntry(poolType, pool, offering, sku, status string, total int, expires string, devices []string) InventoryEntry {
+	free := 0
+	if total > len(devices) {
+		free = total - len(devices)
+	}
+	if devices == nil {
+		devices = []string{}
+	}
+	return InventoryEntry{
+		PoolType: poolType,
+		Pool:     pool,
+		Offering: offering,
+		SKU:      sku,
+		Status:   status,
+		Total:    total,
+		Used:     len(devices),
+		Free:     free,
+		Expires:  expires,
+		Devices:  devices,
+	}
+}
+
+// deviceLabel prefers the device name and falls back to its address.
+func deviceLabel(name, address string) string {
+	if name != "" {
+		return name
+	}
+	return address
+}
+
+// LicenseInventory walks the regkey, purchased and utility pools and reports
+// the capacity, usage, expiry and assigned devices of every pool and
+// offering. Each regkey pool key licenses a single device.
+func (b *BigIQ) LicenseInventory() (*Inventory, error) {
+	inventory := &Inventory{}
+	err := b.walkLicensePools(func(p *licensePool) error {
+		var devices []string
+		for _, m := range p.Members {
+			devices = append(devices, deviceLabel(m.DeviceName, m.DeviceAddress))
+		}
+		entry := newInventoryEntry(p.Type, p.Name, p.Label, p.SKU, p.Status, p.Capacity, p.Expires, devices)
+		inventory.Entries = append(inventory.Entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return inventory, nil
+}
+
+// licensePool is a regkey pool key, a purchased pool or a utility offering,
+// with the devices it licenses.
+type licensePool struct {
+	Type string
+	Name string
+	ID   string
+	// Offering identifies the key or offering within the pool, see
+	// LicenseAssignment; Label is how the inventory shows it.
+	Offering string
+	Label    string
+	SKU      string
+	Status   string
+	Capacity int
+	Expires  string
+	Members  []LicenseAssignment
+}
+
+func (p *licensePool) addMember(id, address, name, machineID, mac string, status LicenseMemberStatus, lastUpdateMicros int64) {
+	p.Members = append(p.Members, LicenseAssignment{
+		PoolType:        p.Type,
+		PoolName:        p.Name,
+		PoolID:          p.ID,
+		Offering:        p.Offering,
+		SKU:             p.SKU,
+		MemberID:        id,
+		DeviceAddress:   address,
+		DeviceName:      name,
+		DeviceMachineID: machineID,
+		MacAddress:      mac,
+		Status:          status,
+		LastUpdate:      microsToTime(lastUpdateMicros),
+	})
+}
+
+// walkLicensePools calls fn for every regkey pool key, purchased pool and
+// utility offering, in that order, and stops at the first error.
+func (b *BigIQ) walkLicensePools(fn func(*licensePool) error) error {
+	for _, walk := range []func(func(*licensePool) error) error{b.walkRegKeyPools, b.walkPurchasedPools, b.walkUtilityPools} {
+		if err := walk(fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *BigIQ) walkRegKeyPools(fn func(*licensePool) error) error {
+	pools, err := b.GetRegPools()
+	if err != nil {
+		return err
+	}
+	for _, pool := range pools.RegKeyPoollist {
+		var offerings regKeyOfferings
+		err, _ := b.getForEntity(&offerings, offeringPath(pool.ID)...)
+		if err != nil {
+			return err
+		}
+		for _, o := range offerings.Items {
+			members, err := b.offeringMembers(pool.ID, o.RegKey)
+			if err != nil {
+				return err
+			}
+			p := &licensePool{
+				Type:     PoolTypeRegKey,
+				Name:     pool.Name,
+				ID:       pool.ID,
+				Offering: o.RegKey,
+				Label:    o.RegKey,
+				Status:   string(o.Status),
+				Capacity: 1,
+				Expires:  o.LicenseState.LicenseEndDateTime,
+			}
+			for _, m := range members {
+				p.addMember(m.ID, m.DeviceAddress, m.DeviceName, m.DeviceMachineID, m.MacAddress, m.Status, m.LastUpdateMicros)
+			}
+			if err := fn(p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (b *BigIQ) walkPurchasedPools(fn func(*licensePool) error) error {
+	pools, err := b.PurchasedPools()
+	if err != nil {
+		return err
+	}
+	for _, pool := range pools {
+		var members purchasedPoolMembers
+		err, _ := b.getForEntity(&members, purchasedPoolPath(pool.UUID, uriMemb)...)
+		if err != nil {
+			return err
+		}
+		p := &licensePool{
+			Type:     PoolTypePurchased,
+			Name:     pool.Name,
+			ID:       pool.UUID,
+			Offering: pool.BaseRegKey,
+			Label:    pool.BaseRegKey,
+			SKU:      pool.SKU,
+			Status:   pool.State,
+			Capacity: pool.Capacity,
+			Expires:  pool.LicenseState.LicenseEndDateTime,
+		}
+		for _, m := range members.Items {
+			p.addMember(m.ID, m.DeviceAddress, m.DeviceName, m.DeviceMachineID, m.MacAddress, m.Status, m.LastUpdateMicros)
+		}
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *BigIQ) walkUtilityPools(fn func(*licensePool) error) error {
+	licenses, err := b.UtilityLicenses()
+	if err != nil {
+		return err
+	}
+	for _, license := range licenses {
+		offerings, err := b.UtilityOfferings(license.RegKey)
+		if err != nil {
+			return err
+		}
+		for _, o := range offerings {
+			var members utilityMembers
+			err, _ := b.getForEntity(&members, utilityLicensePath(license.RegKey, uriOfferings, o.ID, uriMemb)...)
+			if err != nil {
+				return err
+			}
+			p := &licensePool{
+				Type:     PoolTypeUtility,
+				Name:     utilityPoolName(license),
+				ID:       license.RegKey,
+				Offering: o.ID,
+				Label:    o.Description,
+				SKU:      o.Name,
+				Status:   o.Status,
+				Capacity: o.Capacity,
+				Expires:  license.ExpiresDateTime,
+			}
+			for _, m := range members.Items {
+				p.addMember(m.ID, m.DeviceAddress, m.DeviceName, m.DeviceMachineID, m.MacAddress, m.Status, m.LastUpdateMicros)
+			}
+			if err := fn(p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// utilityPoolName is the name member-management tasks know the utility
+// license by.
+func utilityPoolName(license UtilityLicense) string {
+	if license.Name != "" {
+		return license.Name
+	}
+	return license.RegKey
+}
+
+func (e InventoryEntry) row() []string {
+	return []string{
+		e.PoolType,
+		e.Pool,
+		e.Offering,
+		e.SKU,
+		e.Status,
+		strconv.Itoa(e.Total),
+		strconv.Itoa(e.Used),
+		strconv.Itoa(e.Free),
+		e.Expires,
+		strings.Join(e.Devices, " "),
+	}
+}
+
+// WriteJSON writes the inventory to w as indented JSON.
+func (inv *Inventory) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(inv)
+}
+
+// WriteCSV writes the inventory to w as CSV with a header row. Devices are
+// separated by spaces within their column.
+func (inv *Inventory) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(inventoryColumns); err != nil {
+		return err
+	}
+	for _, e := range inv.Entries {
+		if err := cw.Write(e.row()); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteTable writes the inventory to w as an aligned text table.
+func (inv *Inventory) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(inventoryColumns, "\t"))
+	for _, e := range inv.Entries {
+		fmt.Fprintln(tw, strings.Join(e.row(), "\t"))
+	}
+	return tw.Flush()
+}
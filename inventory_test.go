@@ -0,0 +1,81 @@
+package bigiq
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInventoryWriters(t *testing.T) {
+	inventory := &Inventory{Entries: []InventoryEntry{
+		newInventoryEntry(PoolTypePurchased, "pp", "BASE-KEY", "F5-BIG-LTM", "LICENSED", 5, "", []string{"bigip1", "bigip2"}),
+		newInventoryEntry(PoolTypeRegKey, "rk", "REG-KEY", "", "READY", 1, "2030-01-01T00:00:00Z", nil),
+	}}
+	assert.Equal(t, 3, inventory.Entries[0].Free)
+	assert.Equal(t, 1, inventory.Entries[1].Free)
+
+	var csvOut bytes.Buffer
+	assert.Nil(t, inventory.WriteCSV(&csvOut))
+	lines := strings.Split(strings.TrimSpace(csvOut.String()), "\n")
+	assert.Equal(t, "POOL TYPE,POOL,OFFERING,SKU,STATUS,TOTAL,USED,FREE,EXPIRES,DEVICES", lines[0])
+	assert.Equal(t, "purchased,pp,BASE-KEY,F5-BIG-LTM,LICENSED,5,2,3,,bigip1 bigip2", lines[1])
+
+	var table bytes.Buffer
+	assert.Nil(t, inventory.WriteTable(&table))
+	rows := strings.Split(table.String(), "\n")
+	assert.Equal(t, strings.Index(rows[0], "OFFERING"), strings.Index(rows[1], "BASE-KEY"))
+
+	var jsonOut bytes.Buffer
+	assert.Nil(t, inventory.WriteJSON(&jsonOut))
+	assert.Contains(t, jsonOut.String(), `"devices": []`)
+}
+
+func TestLicenseInventoryWalksAllPoolTypes(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		path := r.URL.Path
+		switch {
+		case strings.HasSuffix(path, "/regkey/licenses"):
+			w.Write([]byte(`{"items":[{"id":"rk-1","name":"rk-pool"}]}`))
+		case strings.HasSuffix(path, "/rk-1/offerings"):
+			w.Write([]byte(`{"items":[{"regKey":"REG-KEY","status":"READY","licenseState":{"licenseEndDateTime":"2030-01-01T00:00:00Z"}}]}`))
+		case strings.HasSuffix(path, "/REG-KEY/members"):
+			w.Write([]byte(`{"items":[{"id":"m1","deviceName":"bigip1","deviceAddress":"10.0.0.1"}]}`))
+		case strings.HasSuffix(path, "/purchased-pool/licenses"):
+			w.Write([]byte(`{"items":[{"uuid":"pp-1","name":"pp","baseRegKey":"BASE-KEY","sku":"F5-BIG-LTM","state":"LICENSED","capacity":5}]}`))
+		case strings.HasSuffix(path, "/pp-1/members"):
+			w.Write([]byte(`{"items":[{"id":"m2","deviceAddress":"10.0.0.2"},{"id":"m3","deviceName":"bigip3"}]}`))
+		case strings.HasSuffix(path, "/utility/licenses"):
+			w.Write([]byte(`{"items":[{"regKey":"UTIL-KEY","expiresDateTime":"2031-01-01T00:00:00Z"}]}`))
+		case strings.HasSuffix(path, "/UTIL-KEY/offerings"):
+			w.Write([]byte(`{"items":[{"id":"off-1","name":"F5-BIG-MSP-BT-10G","description":"Better 10G","status":"READY","capacity":10}]}`))
+		case strings.HasSuffix(path, "/off-1/members"):
+			w.Write([]byte(`{"items":[{"id":"m4","deviceAddress":"10.0.0.4"}]}`))
+		default:
+			w.Write([]byte(`{"items":[]}`))
+		}
+	}))
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+
+	inventory, err := b.LicenseInventory()
+
+	assert.Nil(t, err)
+	assert.Equal(t, []InventoryEntry{
+		newInventoryEntry(PoolTypeRegKey, "rk-pool", "REG-KEY", "", "READY", 1, "2030-01-01T00:00:00Z", []string{"bigip1"}),
+		newInventoryEntry(PoolTypePurchased, "pp", "BASE-KEY", "F5-BIG-LTM", "LICENSED", 5, "", []string{"10.0.0.2", "bigip3"}),
+		newInventoryEntry(PoolTypeUtility, "UTIL-KEY", "Better 10G", "F5-BIG-MSP-BT-10G", "READY", 10, "2031-01-01T00:00:00Z", []string{"10.0.0.4"}),
+	}, inventory.Entries)
+
+	assignments, err := b.LicenseAssignments()
+	assert.Nil(t, err)
+	var members []string
+	for _, a := range assignments {
+		members = append(members, a.PoolType+"/"+a.PoolName+"/"+a.Offering+"/"+a.MemberID)
+	}
+	assert.Equal(t, []string{"regkey/rk-pool/REG-KEY/m1", "purchased/pp/BASE-KEY/m2", "purchased/pp/BASE-KEY/m3", "utility/UTIL-KEY/off-1/m4"}, members)
+}
@@ -0,0 +1,281 @@
+package bigiq
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// Outcomes of a KeyImportResult.
+const (
+	ImportActivated = "activated"
+	ImportDossier   = "dossier"
+	ImportSkipped   = "skipped"
+	ImportFailed    = "failed"
+)
+
+// KeyImportRow is one registration key to import into a regkey pool.
+type KeyImportRow struct {
+	Pool        string `json:"pool"`
+	RegKey      string `json:"regKey"`
+	Description string `json:"description,omitempty"`
+}
+
+// KeyImportOptions controls ImportRegKeys.
+type KeyImportOptions struct {
+	// Manual starts offline activations and collects their dossiers
+	// instead of activating with the F5 license server. Complete them with
+	// CompleteManualOfferingActivation.
+	Manual bool
+	// Activation is used for automatic activations. Its RegKey and Name are
+	// taken from each row.
+	Activation ActivationOptions
+	// PoolDescription is the description of regkey pools that are created.
+	PoolDescription string
+}
+
+// KeyImportResult is the outcome for one row of an import.
+type KeyImportResult struct {
+	Row         int              `json:"row"`
+	Pool        string           `json:"pool"`
+	RegKey      string           `json:"regKey"`
+	Outcome     string           `json:"outcome"`
+	PoolCreated bool             `json:"poolCreated,omitempty"`
+	Status      ActivationStatus `json:"status,omitempty"`
+	Dossier     string           `json:"dossier,omitempty"`
+	Error       string           `json:"error,omitempty"`
+}
+
+// KeyImportReport is the outcome of ImportRegKeys, one result per row.
+type KeyImportReport struct {
+	Results []KeyImportResult `json:"results"`
+}
+
+// ReadKeyImportCSV reads import rows from CSV with a header row. The pool and
+// regkey columns are required, description is optional; column names are
+// case-insensitive and "reg key", "regKey" and "reg-key" are accepted.
+func ReadKeyImportCSV(r io.Reader) ([]KeyImportRow, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("key import CSV is empty")
+	}
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		name = strings.NewReplacer(" ", "", "-", "", "_", "").Replace(strings.ToLower(strings.TrimSpace(name)))
+		columns[name] = i
+	}
+	poolCol, okPool := columns["pool"]
+	keyCol, okKey := columns["regkey"]
+	if !okPool || !okKey {
+		return nil, fmt.Errorf("key import CSV needs pool and regkey columns, got %v", records[0])
+	}
+	descCol, okDesc := columns["description"]
+	rows := make([]KeyImportRow, 0, len(records)-1)
+	for _, rec := range records[1:] {
+		row := KeyImportRow{Pool: strings.TrimSpace(rec[poolCol]), RegKey: strings.TrimSpace(rec[keyCol])}
+		if okDesc {
+			row.Description = strings.TrimSpace(rec[descCol])
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// ReadKeyImportJSON reads import rows from a JSON array of KeyImportRow.
+func ReadKeyImportJSON(r io.Reader) ([]KeyImportRow, error) {
+	var rows []KeyImportRow
+	if err := json.NewDecoder(r).Decode(&rows); err != nil {
+		return nil, fmt.Errorf("parsing key import JSON: %v", err)
+	}
+	return rows, nil
+}
+
+// ImportRegKeys adds each row's key to its regkey pool, creating missing
+// pools with CreateRegPool, and activates it automatically (accepting the
+// EULA) or, with opts.Manual, starts a manual activation and records its
+// dossier. Keys already in their pool, or imported by an earlier row, are
+// skipped; a key whose earlier row failed is tried again. Failed rows are
+// recorded in the report and do not stop the import.
+func (b *BigIQ) ImportRegKeys(ctx context.Context, rows []KeyImportRow, opts KeyImportOptions) (*KeyImportReport, error) {
+	report := &KeyImportReport{Results: make([]KeyImportResult, 0, len(rows))}
+	existing := make(map[string]map[string]bool)
+	poolErrs := make(map[string]error)
+	for i, row := range rows {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		result := KeyImportResult{Row: i + 1, Pool: row.Pool, RegKey: row.RegKey}
+		if row.Pool == "" || row.RegKey == "" {
+			result.fail(fmt.Errorf("pool and regkey are required"))
+			report.Results = append(report.Results, result)
+			continue
+		}
+		keys, ok := existing[row.Pool]
+		if !ok && poolErrs[row.Pool] == nil {
+			var err error
+			keys, result.PoolCreated, err = b.importPool(row.Pool, opts.PoolDescription)
+			if err != nil {
+				poolErrs[row.Pool] = err
+			} else {
+				existing[row.Pool] = keys
+			}
+		}
+		imported, seen := keys[row.RegKey]
+		switch {
+		case poolErrs[row.Pool] != nil:
+			result.fail(poolErrs[row.Pool])
+		case imported:
+			result.Outcome = ImportSkipped
+		default:
+			if seen {
+				// An earlier row failed with this key, possibly after adding
+				// it to the pool.
+				b.retryKey(ctx, row, opts, &result)
+			} else {
+				b.importKey(ctx, row, opts, &result)
+			}
+			// A failed key is tried again if it appears in a later row.
+			keys[row.RegKey] = result.Outcome != ImportFailed
+		}
+		if result.Outcome == ImportFailed {
+			log.Printf("[ERROR] importing REG-KEY %s into pool %s: %s", row.RegKey, row.Pool, result.Error)
+		}
+		report.Results = append(report.Results, result)
+	}
+	return report, nil
+}
+
+// importPool returns the keys already in the named regkey pool, creating the
+// pool if it does not exist.
+func (b *BigIQ) importPool(pool, description string) (map[string]bool, bool, error) {
+	poolID, err := b.GetRegkeyPoolId(pool)
+	if err != nil {
+		return nil, false, err
+	}
+	keys := make(map[string]bool)
+	if poolID == "" {
+		if _, err := b.CreateRegPool(description, pool); err != nil {
+			return nil, false, fmt.Errorf("creating regkey pool %s: %v", pool, err)
+		}
+		return keys, true, nil
+	}
+	var offerings regKeyOfferings
+	err, _ = b.getForEntity(&offerings, offeringPath(poolID)...)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, o := range offerings.Items {
+		keys[o.RegKey] = true
+	}
+	return keys, false, nil
+}
+
+func (b *BigIQ) importKey(ctx context.Context, row KeyImportRow, opts KeyImportOptions, result *KeyImportResult) {
+	if opts.Manual {
+		activation, err := b.StartManualOfferingActivation(row.Pool, row.RegKey, row.Description)
+		if err != nil {
+			result.fail(err)
+			return
+		}
+		result.Status = activation.Status
+		dossier, err := b.WaitForOfferingDossier(ctx, row.Pool, row.RegKey)
+		if err != nil {
+			result.fail(err)
+			return
+		}
+		result.Outcome = ImportDossier
+		result.Status = ActivationNeedLicenseText
+		result.Dossier = dossier
+		return
+	}
+	activationOpts := opts.Activation
+	activationOpts.RegKey = row.RegKey
+	activationOpts.Name = row.Description
+	activation, err := b.ActivateRegKeyOffering(ctx, row.Pool, activationOpts)
+	if activation != nil {
+		result.Status = activation.Status
+	}
+	if err != nil {
+		result.fail(err)
+		return
+	}
+	result.Outcome = ImportActivated
+}
+
+// retryKey imports a key whose earlier import failed. BIG-IQ refuses to add a
+// key that is already in the pool, so an offering left behind by the failed
+// attempt is removed first, unless it has been activated since.
+func (b *BigIQ) retryKey(ctx context.Context, row KeyImportRow, opts KeyImportOptions, result *KeyImportResult) {
+	poolID, err := b.regkeyPoolID(row.Pool)
+	if err != nil {
+		result.fail(err)
+		return
+	}
+	path := offeringPath(poolID, row.RegKey)
+	var offering RegKeyOffering
+	err, ok := b.getForEntity(&offering, path...)
+	if err != nil {
+		result.fail(err)
+		return
+	}
+	if ok {
+		if offering.Status.Succeeded() {
+			result.Outcome = ImportSkipped
+			result.Status = offering.Status
+			return
+		}
+		log.Printf("[INFO] removing REG-KEY %s from pool %s before retrying its import", row.RegKey, row.Pool)
+		if err := b.delete(path...); err != nil {
+			result.fail(err)
+			return
+		}
+	}
+	b.importKey(ctx, row, opts, result)
+}
+
+func (r *KeyImportResult) fail(err error) {
+	r.Outcome = ImportFailed
+	r.Error = err.Error()
+}
+
+// Failed returns the results that failed.
+func (r *KeyImportReport) Failed() []KeyImportResult {
+	var failed []KeyImportResult
+	for _, result := range r.Results {
+		if result.Outcome == ImportFailed {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// WriteJSON writes the per-row results to w as indented JSON.
+func (r *KeyImportReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteCSV writes one row per imported key to w, with a header row.
+func (r *KeyImportReport) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"ROW", "POOL", "REGKEY", "OUTCOME", "POOL CREATED", "STATUS", "DOSSIER", "ERROR"}); err != nil {
+		return err
+	}
+	for _, res := range r.Results {
+		row := []string{strconv.Itoa(res.Row), res.Pool, res.RegKey, res.Outcome, strconv.FormatBool(res.PoolCreated), string(res.Status), res.Dossier, res.Error}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,130 @@
+package bigiq
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportRegKeys(t *testing.T) {
+	rows, err := ReadKeyImportCSV(strings.NewReader("Pool,Reg Key,Description\nold,AAAAA,existing\nnew,BBBBB,fresh\nnew,BBBBB,duplicate\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(rows))
+
+	pools := `{"id":"pool-1","name":"old"}`
+	var createdPools, addedKeys []string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		path := r.URL.Path
+		switch {
+		case strings.HasSuffix(path, "/regkey/licenses") && r.Method == http.MethodPost:
+			var pool RegPool
+			json.NewDecoder(r.Body).Decode(&pool)
+			createdPools = append(createdPools, pool.Name)
+			pools += `,{"id":"pool-2","name":"` + pool.Name + `"}`
+			w.Write([]byte(`{}`))
+		case strings.HasSuffix(path, "/regkey/licenses"):
+			w.Write([]byte(`{"items":[` + pools + `]}`))
+		case strings.HasSuffix(path, "/pool-1/offerings"):
+			w.Write([]byte(`{"items":[{"regKey":"AAAAA","status":"READY"}]}`))
+		case strings.HasSuffix(path, "/offerings") && r.Method == http.MethodPost:
+			var body regKeyOfferingRequest
+			json.NewDecoder(r.Body).Decode(&body)
+			addedKeys = append(addedKeys, body.RegKey)
+			json.NewEncoder(w).Encode(Activation{RegKey: body.RegKey, Status: body.Status})
+		case strings.HasSuffix(path, "/offerings"):
+			w.Write([]byte(`{"items":[]}`))
+		default:
+			json.NewEncoder(w).Encode(Activation{RegKey: "BBBBB", Status: OfferingReady})
+		}
+	}))
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+
+	report, err := b.ImportRegKeys(context.Background(), rows, KeyImportOptions{
+		Activation: ActivationOptions{PollInterval: time.Millisecond},
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"new"}, createdPools)
+	assert.Equal(t, []string{"BBBBB"}, addedKeys)
+	outcomes := []string{}
+	for _, res := range report.Results {
+		outcomes = append(outcomes, res.Outcome)
+	}
+	assert.Equal(t, []string{ImportSkipped, ImportActivated, ImportSkipped}, outcomes)
+	assert.True(t, report.Results[1].PoolCreated)
+	assert.Empty(t, report.Failed())
+
+	var buf bytes.Buffer
+	assert.Nil(t, report.WriteCSV(&buf))
+	assert.Contains(t, buf.String(), "2,new,BBBBB,activated,true,READY,,")
+}
+
+func TestImportRegKeysRetriesFailedDuplicate(t *testing.T) {
+	rows := []KeyImportRow{{Pool: "pool", RegKey: "AAAAA"}, {Pool: "pool", RegKey: "AAAAA"}, {Pool: "pool", RegKey: "AAAAA"}, {Pool: "pool", RegKey: "AAAAA"}}
+	// The first attempt is refused, the second is added but fails to
+	// activate and the third finds the failed offering and replaces it.
+	var requests []string
+	var offering ActivationStatus
+	activations := []ActivationStatus{OfferingActivationFailed, OfferingReady}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		path := r.URL.Path
+		switch {
+		case strings.HasSuffix(path, "/regkey/licenses"):
+			w.Write([]byte(`{"items":[{"id":"pool-1","name":"pool"}]}`))
+		case strings.HasSuffix(path, "/offerings") && r.Method == http.MethodPost:
+			requests = append(requests, "POST")
+			if len(requests) == 1 {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"code":400,"message":"license server unreachable"}`))
+				return
+			}
+			if offering != "" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"code":400,"message":"REG-KEY AAAAA already exists"}`))
+				return
+			}
+			offering = ActivationAutomatic
+			json.NewEncoder(w).Encode(Activation{RegKey: "AAAAA", Status: offering})
+		case strings.HasSuffix(path, "/offerings"):
+			w.Write([]byte(`{"items":[]}`))
+		case r.Method == http.MethodDelete:
+			requests = append(requests, "DELETE "+string(offering))
+			offering = ""
+			w.Write([]byte(`{}`))
+		case offering == "":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"code":404,"message":"not found"}`))
+		default:
+			if offering == ActivationAutomatic {
+				offering, activations = activations[0], activations[1:]
+			}
+			json.NewEncoder(w).Encode(Activation{RegKey: "AAAAA", Status: offering})
+		}
+	}))
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+
+	report, err := b.ImportRegKeys(context.Background(), rows, KeyImportOptions{
+		Activation: ActivationOptions{PollInterval: time.Millisecond},
+	})
+
+	assert.Nil(t, err)
+	outcomes := []string{}
+	for _, res := range report.Results {
+		outcomes = append(outcomes, res.Outcome)
+	}
+	assert.Equal(t, []string{ImportFailed, ImportFailed, ImportActivated, ImportSkipped}, outcomes)
+	assert.Equal(t, OfferingActivationFailed, report.Results[1].Status)
+	assert.Equal(t, OfferingReady, report.Results[2].Status)
+	assert.Equal(t, []string{"POST", "POST", "DELETE ACTIVATION_FAILED", "POST"}, requests)
+}
@@ -0,0 +1,118 @@
+package bigiq
+
+import (
+	"fmt"
+	"net"
+)
+
+// LicenseCommand is the command of a member-management license task.
+type LicenseCommand string
+
+const (
+	LicenseAssign LicenseCommand = "assign"
+	LicenseRevoke LicenseCommand = "revoke"
+)
+
+// AssignmentType tells BIG-IQ how to reach the device being licensed.
+type AssignmentType string
+
+const (
+	// AssignmentManaged licenses a device BIG-IQ manages. It is the default.
+	AssignmentManaged AssignmentType = "MANAGED"
+	// AssignmentUnmanaged licenses a device BIG-IQ logs in to with User and
+	// Password.
+	AssignmentUnmanaged AssignmentType = "UNMANAGED"
+	// AssignmentUnreachable licenses a device BIG-IQ cannot contact,
+	// identified by MacAddress and Hypervisor.
+	AssignmentUnreachable AssignmentType = "UNREACHABLE"
+)
+
+// Hypervisor is the platform of an unreachable device.
+type Hypervisor string
+
+const (
+	HypervisorAWS    Hypervisor = "aws"
+	HypervisorAzure  Hypervisor = "azure"
+	HypervisorGCE    Hypervisor = "gce"
+	HypervisorVMware Hypervisor = "vmware"
+	HypervisorHyperV Hypervisor = "hyperv"
+	HypervisorKVM    Hypervisor = "kvm"
+	HypervisorXen    Hypervisor = "xen"
+)
+
+func (h Hypervisor) valid() bool {
+	switch h {
+	case HypervisorAWS, HypervisorAzure, HypervisorGCE, HypervisorVMware, HypervisorHyperV, HypervisorKVM, HypervisorXen:
+		return true
+	}
+	return false
+}
+
+// Validate checks the fields of a license task and their combinations
+// before anything is sent to BIG-IQ. It cannot tell whether
+// LicensePoolName is a utility pool; PostLicense checks that as well.
+func (p *LicenseParam) Validate() error {
+	switch p.Command {
+	case LicenseAssign, LicenseRevoke:
+	default:
+		return fmt.Errorf("invalid license command %q: must be %s or %s", p.Command, LicenseAssign, LicenseRevoke)
+	}
+	if p.Address == "" {
+		return fmt.Errorf("license %s requires an address", p.Command)
+	}
+	if p.MacAddress != "" {
+		if _, err := net.ParseMAC(p.MacAddress); err != nil {
+			return fmt.Errorf("invalid MAC address %q", p.MacAddress)
+		}
+	}
+	if p.Hypervisor != "" && !p.Hypervisor.valid() {
+		return fmt.Errorf("invalid hypervisor %q", p.Hypervisor)
+	}
+	if p.UnitOfMeasure != "" && !validUnitOfMeasure(p.UnitOfMeasure) {
+		return fmt.Errorf("invalid unit of measure %q", p.UnitOfMeasure)
+	}
+	switch p.AssignmentType {
+	case "", AssignmentManaged:
+	case AssignmentUnmanaged:
+		if p.User == "" || p.Password == "" {
+			return fmt.Errorf("%s license %s of %s requires user and password", p.AssignmentType, p.Command, p.Address)
+		}
+	case AssignmentUnreachable:
+		if p.MacAddress == "" {
+			return fmt.Errorf("%s license %s of %s requires a MAC address", p.AssignmentType, p.Command, p.Address)
+		}
+		if p.Command == LicenseAssign && p.Hypervisor == "" {
+			return fmt.Errorf("%s license assign of %s requires a hypervisor", p.AssignmentType, p.Address)
+		}
+	default:
+		return fmt.Errorf("invalid assignment type %q", p.AssignmentType)
+	}
+	return nil
+}
+
+// validateLicenseParam runs Validate and then checks that a unit of measure
+// is only given for a utility license. The utility licenses are only looked
+// up then; BIG-IQ itself rejects a utility assign without a unit of measure.
+func (b *BigIQ) validateLicenseParam(config *LicenseParam) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	if config.Command != LicenseAssign || config.LicensePoolName == "" || config.UnitOfMeasure == "" {
+		return nil
+	}
+	licenses, err := b.UtilityLicenses()
+	if err != nil {
+		return err
+	}
+	utility := false
+	for _, license := range licenses {
+		if config.LicensePoolName == utilityPoolName(license) || config.LicensePoolName == license.RegKey {
+			utility = true
+			break
+		}
+	}
+	if !utility {
+		return fmt.Errorf("unit of measure is only allowed for utility pools, not %s", config.LicensePoolName)
+	}
+	return nil
+}
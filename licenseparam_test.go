@@ -0,0 +1,72 @@
+package bigiq
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLicenseParamValidate(t *testing.T) {
+	cases := []struct {
+		config LicenseParam
+		err    string
+	}{
+		{LicenseParam{Command: LicenseAssign, Address: "10.0.0.1"}, ""},
+		{LicenseParam{Command: "asign", Address: "10.0.0.1"}, "invalid license command"},
+		{LicenseParam{Command: LicenseAssign}, "requires an address"},
+		{LicenseParam{Command: LicenseAssign, Address: "10.0.0.1", AssignmentType: AssignmentUnreachable, Hypervisor: HypervisorKVM}, "requires a MAC address"},
+		{LicenseParam{Command: LicenseAssign, Address: "10.0.0.1", AssignmentType: AssignmentUnreachable, MacAddress: "00:11:22:33:44:55"}, "requires a hypervisor"},
+		{LicenseParam{Command: LicenseRevoke, Address: "10.0.0.1", AssignmentType: AssignmentUnreachable, MacAddress: "00:11:22:33:44:55"}, ""},
+		{LicenseParam{Command: LicenseAssign, Address: "10.0.0.1", MacAddress: "not-a-mac"}, "invalid MAC address"},
+		{LicenseParam{Command: LicenseAssign, Address: "10.0.0.1", Hypervisor: "virtualbox"}, "invalid hypervisor"},
+		{LicenseParam{Command: LicenseAssign, Address: "10.0.0.1", AssignmentType: AssignmentUnmanaged, User: "admin"}, "requires user and password"},
+		{LicenseParam{Command: LicenseAssign, Address: "10.0.0.1", UnitOfMeasure: "weekly"}, "invalid unit of measure"},
+		{LicenseParam{Command: LicenseAssign, Address: "10.0.0.1", AssignmentType: "REMOTE"}, "invalid assignment type"},
+	}
+	for _, c := range cases {
+		err := c.config.Validate()
+		if c.err == "" {
+			assert.Nil(t, err)
+		} else if assert.NotNil(t, err) {
+			assert.Contains(t, err.Error(), c.err)
+		}
+	}
+}
+
+func TestPostLicenseValidatesBeforePosting(t *testing.T) {
+	var requests []string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/utility/licenses"):
+			w.Write([]byte(`{"items":[{"regKey":"UTIL-KEY","name":"utility"}]}`))
+		default:
+			w.Write([]byte(`{"id":"task-1"}`))
+		}
+	}))
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+
+	_, err := b.PostLicense(&LicenseParam{Command: LicenseAssign, Address: "10.0.0.1", AssignmentType: AssignmentUnmanaged})
+	assert.Contains(t, err.Error(), "requires user and password")
+	assert.Empty(t, requests)
+
+	_, err = b.PostLicense(&LicenseParam{Command: LicenseAssign, Address: "10.0.0.1", LicensePoolName: "rk-pool", UnitOfMeasure: UnitHourly})
+	assert.Contains(t, err.Error(), "only allowed for utility pools")
+	assert.Equal(t, []string{"GET /mgmt/cm/device/licensing/pool/utility/licenses"}, requests)
+
+	requests = nil
+	id, err := b.PostLicense(&LicenseParam{Command: LicenseAssign, Address: "10.0.0.1", LicensePoolName: "rk-pool"})
+	assert.Nil(t, err)
+	assert.Equal(t, "task-1", id)
+	assert.Equal(t, []string{"POST /mgmt/cm/device/tasks/licensing/pool/member-management"}, requests)
+
+	requests = nil
+	_, err = b.PostLicense(&LicenseParam{Command: LicenseAssign, Address: "10.0.0.1", LicensePoolName: "utility", UnitOfMeasure: UnitHourly})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(requests))
+}
@@ -0,0 +1,114 @@
+package bigiq
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Metrics receives instrumentation from the library. Implementations must be
+// safe for concurrent use. Set BigIQ.Metrics (or ConfigOptions.Metrics before
+// creating a session) to collect them; see PrometheusMetrics for an adapter
+// that exposes them in the Prometheus text format.
+type Metrics interface {
+	// ObserveRequest records a completed API call. path is a template with
+	// identifiers replaced (see PathTemplate) and status is zero when no
+	// response was received.
+	ObserveRequest(method, path string, status int, duration time.Duration)
+	// IncRetry records that operation was retried.
+	IncRetry(operation string)
+	// IncTokenRefresh records that an expired or rejected authentication
+	// token was re-acquired. The initial login of a session is not counted.
+	IncTokenRefresh()
+	// ObserveTaskPoll records a finished wait on an asynchronous task such as
+	// a license assignment or an AS3 declaration.
+	ObserveTaskPoll(task string, iterations int, duration time.Duration)
+	// ObserveUpload records a completed file upload.
+	ObserveUpload(bytes int64, duration time.Duration)
+}
+
+// Task names reported through Metrics.ObserveTaskPoll.
+const (
+	TaskLicense       = "license"
+	TaskLicenseMember = "license-member"
+	TaskAS3           = "as3"
+	TaskBigIQLicense  = "bigiq-license"
+	TaskUsageReport   = "usage-report"
+	TaskDevice        = "device"
+)
+
+type noopMetrics struct{}
+
+func (noopMetrics) ObserveRequest(string, string, int, time.Duration) {}
+func (noopMetrics) IncRetry(string)                                   {}
+func (noopMetrics) IncTokenRefresh()                                  {}
+func (noopMetrics) ObserveTaskPoll(string, int, time.Duration)        {}
+func (noopMetrics) ObserveUpload(int64, time.Duration)                {}
+
+func (b *BigIQ) metrics() Metrics {
+	if b.Metrics == nil {
+		return noopMetrics{}
+	}
+	return b.Metrics
+}
+
+var (
+	uuidSegment    = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	regKeySegment  = regexp.MustCompile(`^[A-Z]{5}(-[A-Z]{5,7}){4}$`)
+	numericSegment = regexp.MustCompile(`^[0-9]+$`)
+	addressSegment = regexp.MustCompile(`^[0-9a-fA-F.:]+$`)
+)
+
+// PathTemplate reduces a request URL to a low-cardinality template by
+// dropping the query string and replacing UUIDs, registration keys, numeric
+// IDs and addresses with placeholders, e.g.
+// "mgmt/cm/device/licensing/pool/regkey/licenses/{id}/offerings/{regkey}".
+func PathTemplate(url string) string {
+	if i := strings.IndexByte(url, '?'); i >= 0 {
+		url = url[:i]
+	}
+	parts := strings.Split(strings.Trim(url, "/"), "/")
+	for i, p := range parts {
+		switch {
+		case uuidSegment.MatchString(p):
+			parts[i] = "{id}"
+		case regKeySegment.MatchString(p):
+			parts[i] = "{regkey}"
+		case numericSegment.MatchString(p):
+			parts[i] = "{id}"
+		case strings.ContainsAny(p, ".:") && addressSegment.MatchString(p):
+			parts[i] = "{address}"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// pollTask calls check every interval until it reports done, fails or ctx is
+// cancelled, and records the number of iterations and the total wait under
+// task.
+func (b *BigIQ) pollTask(ctx context.Context, task string, interval time.Duration, check func() (bool, error)) error {
+	start := time.Now()
+	iterations := 0
+	defer func() {
+		b.metrics().ObserveTaskPoll(task, iterations, time.Since(start))
+	}()
+	for {
+		iterations++
+		done, err := check()
+		if err != nil || done {
+			return err
+		}
+		if interval <= 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package bigiq
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPathTemplate(t *testing.T) {
+	assert.Equal(t,
+		"mgmt/cm/device/licensing/pool/regkey/licenses/{id}/offerings/{regkey}/members/{id}",
+		PathTemplate("mgmt/cm/device/licensing/pool/regkey/licenses/f37c66e0-a80d-43e8-924b-3bbe9fe96bbe/offerings/FDKOC-UVGUE-FDURD-AYYDH-IXDSOYV/members/fb7b7c65-5551-4ab2-a35a-659d47533e6b"))
+	assert.Equal(t, "mgmt/shared/appsvcs/declare/Tenant1", PathTemplate("mgmt/shared/appsvcs/declare/Tenant1?async=true"))
+	assert.Equal(t, "mgmt/shared/resolver/device-groups/{address}", PathTemplate("mgmt/shared/resolver/device-groups/10.1.1.1"))
+}
+
+func TestPrometheusMetricsRecordsRequests(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"items":[]}`))
+	}))
+	defer server.Close()
+
+	m := NewPrometheusMetrics()
+	b := NewSession(server.URL, "", "", "", &ConfigOptions{APICallTimeout: 5 * time.Second, Metrics: m})
+	_, err := b.GetRegPools()
+	assert.Nil(t, err)
+	m.ObserveTaskPoll(TaskLicense, 3, 2*time.Second)
+
+	var out bytes.Buffer
+	_, err = m.WriteTo(&out)
+	assert.Nil(t, err)
+	assert.Contains(t, out.String(), `bigiq_api_requests_total{method="GET",path="mgmt/cm/device/licensing/pool/regkey/licenses",status="200"} 1`)
+	assert.Contains(t, out.String(), `bigiq_task_poll_iterations_total{task="license"} 3`)
+	assert.Contains(t, out.String(), `bigiq_task_duration_seconds_bucket{task="license",le="2.5"} 1`)
+	assert.Contains(t, out.String(), `bigiq_task_duration_seconds_bucket{task="license",le="1"} 0`)
+}
+
+func TestTokenRefreshCountsReacquisitionOnly(t *testing.T) {
+	logins := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/mgmt/shared/authn/login" {
+			logins++
+			fmt.Fprintf(w, `{"token":{"token":"token-%d"}}`, logins)
+			return
+		}
+		if r.Header.Get("X-F5-Auth-Token") != "token-2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"code":401,"message":"Authorization failed"}`))
+			return
+		}
+		w.Write([]byte(`{"items":[]}`))
+	}))
+	defer server.Close()
+
+	m := NewPrometheusMetrics()
+	b, err := NewTokenSession(server.URL, "", "admin", "secret", "tmos", &ConfigOptions{APICallTimeout: 5 * time.Second, Metrics: m})
+	assert.Nil(t, err)
+	var out bytes.Buffer
+	m.WriteTo(&out)
+	assert.Contains(t, out.String(), "bigiq_token_refreshes_total 0")
+
+	_, err = b.GetRegPools()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, logins)
+	assert.Equal(t, "token-2", b.Token)
+	out.Reset()
+	m.WriteTo(&out)
+	assert.Contains(t, out.String(), "bigiq_token_refreshes_total 1")
+}
+
+func TestAS3RestartIsOneTaskObservation(t *testing.T) {
+	patches := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodPatch:
+			patches++
+			fmt.Fprintf(w, `{"id":"t%d"}`, patches)
+		case strings.HasSuffix(r.URL.Path, "/task/t1"):
+			w.Write([]byte(`{"id":"t1","results":[{"code":503,"message":"busy"}]}`))
+		case strings.HasSuffix(r.URL.Path, "/task"):
+			w.Write([]byte(`{"items":[{"id":"other","results":[{"code":0,"message":"in progress"}]}]}`))
+		default:
+			w.Write([]byte(`{"id":"x","results":[{"code":200,"message":"success"}]}`))
+		}
+	}))
+	defer server.Close()
+
+	m := NewPrometheusMetrics()
+	b := NewSession(server.URL, "", "", "", &ConfigOptions{APICallTimeout: 5 * time.Second, Metrics: m})
+	assert.Nil(t, b.ModifyAs3("Tenant1", `{}`))
+
+	var out bytes.Buffer
+	m.WriteTo(&out)
+	assert.Equal(t, 2, patches)
+	assert.Contains(t, out.String(), `bigiq_task_duration_seconds_count{task="as3"} 1`)
+	assert.Contains(t, out.String(), `bigiq_task_poll_iterations_total{task="as3"} 3`)
+	assert.Contains(t, out.String(), `bigiq_retries_total{operation="as3"} 1`)
+}
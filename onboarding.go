@@ -0,0 +1,358 @@
+package bigiq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	uriGlobal          = "global"
+	uriSystem          = "system"
+	uriMachineResolver = "machineid-resolver"
+	uriDeviceTrust     = "device-trust"
+	uriDeviceDiscovery = "device-discovery"
+	uriDeclareMgmt     = "declare-mgmt-authority"
+
+	defaultOnboardPollInterval = 5 * time.Second
+)
+
+// DeviceModule is a BIG-IP module BIG-IQ can discover and import.
+type DeviceModule string
+
+const (
+	ModuleLTM DeviceModule = "adc_core"
+	ModuleASM DeviceModule = "asm"
+	ModuleAFM DeviceModule = "firewall"
+	ModuleDNS DeviceModule = "dns"
+	ModuleAPM DeviceModule = "access"
+	// ModuleSecurityShared holds the objects ASM and AFM share. Discovery
+	// and import add it whenever ASM or AFM is requested.
+	ModuleSecurityShared DeviceModule = "security_shared"
+)
+
+// importPath is the path segment of the module's import tasks.
+func (m DeviceModule) importPath() string {
+	return strings.Replace(string(m), "_", "-", -1)
+}
+
+// withSharedModules returns modules, LTM first, with ModuleSecurityShared
+// added when ASM or AFM is among them.
+func withSharedModules(modules []DeviceModule) []DeviceModule {
+	result := []DeviceModule{ModuleLTM}
+	security := false
+	for _, m := range modules {
+		if m == ModuleASM || m == ModuleAFM {
+			security = true
+		}
+		if m != ModuleLTM && m != ModuleSecurityShared {
+			result = append(result, m)
+		}
+	}
+	if security {
+		result = append(result[:1], append([]DeviceModule{ModuleSecurityShared}, result[1:]...)...)
+	}
+	return result
+}
+
+// DeviceTaskStatus is the status of a device trust, discovery or import task.
+type DeviceTaskStatus string
+
+const (
+	DeviceTaskStarted   DeviceTaskStatus = "STARTED"
+	DeviceTaskFinished  DeviceTaskStatus = "FINISHED"
+	DeviceTaskFailed    DeviceTaskStatus = "FAILED"
+	DeviceTaskCancelled DeviceTaskStatus = "CANCELED"
+	// DeviceTaskPendingUpgrade means the device needs its REST framework
+	// upgraded before BIG-IQ can trust it.
+	DeviceTaskPendingUpgrade DeviceTaskStatus = "PENDING_FRAMEWORK_UPGRADE_CONFIRMATION"
+	// DeviceTaskPendingConflicts means an import found objects that differ
+	// between BIG-IQ and the device.
+	DeviceTaskPendingConflicts DeviceTaskStatus = "PENDING_CONFLICTS"
+)
+
+// Done reports whether the task has finished, successfully or not.
+func (s DeviceTaskStatus) Done() bool {
+	return s == DeviceTaskFinished || s == DeviceTaskFailed || s == DeviceTaskCancelled
+}
+
+// ConflictPolicy decides how import conflicts are resolved.
+type ConflictPolicy string
+
+const (
+	// ConflictUseBigIP keeps the configuration found on the device.
+	ConflictUseBigIP ConflictPolicy = "USE_BIGIP"
+	// ConflictUseBigIQ keeps the configuration BIG-IQ already has.
+	ConflictUseBigIQ ConflictPolicy = "USE_BIGIQ"
+	// ConflictAbort fails the import when there are conflicts.
+	ConflictAbort ConflictPolicy = "ABORT"
+)
+
+// ImportConflict is an object that differs between BIG-IQ and the device.
+type ImportConflict struct {
+	FromReference DeviceRef `json:"fromReference"`
+	ToReference   DeviceRef `json:"toReference"`
+	Resolution    string    `json:"resolution,omitempty"`
+}
+
+// DeviceTask is a device trust, discovery or import task.
+type DeviceTask struct {
+	ID           string           `json:"id"`
+	Name         string           `json:"name,omitempty"`
+	Status       DeviceTaskStatus `json:"status"`
+	CurrentStep  string           `json:"currentStep,omitempty"`
+	Address      string           `json:"address,omitempty"`
+	MachineID    string           `json:"machineId,omitempty"`
+	Conflicts    []ImportConflict `json:"conflicts,omitempty"`
+	ErrorMessage string           `json:"errorMessage,omitempty"`
+	StartTime    string           `json:"startDateTime,omitempty"`
+	EndTime      string           `json:"endDateTime,omitempty"`
+	SelfLink     string           `json:"selfLink,omitempty"`
+
+	// kind and collection locate the task for WaitForDeviceTask.
+	kind       string
+	collection []string
+}
+
+// pendingConflicts reports whether an import waits for conflicts to be
+// resolved. Depending on the version BIG-IQ reports this as the status or
+// as the current step.
+func (t *DeviceTask) pendingConflicts() bool {
+	return t.Status == DeviceTaskPendingConflicts || t.CurrentStep == string(DeviceTaskPendingConflicts)
+}
+
+// DeviceTaskError is returned when a device task fails or cannot continue.
+type DeviceTaskError struct {
+	Kind    string
+	ID      string
+	Status  DeviceTaskStatus
+	Step    string
+	Message string
+}
+
+func (e *DeviceTaskError) Error() string {
+	msg := fmt.Sprintf("device %s task %s ended in %s", e.Kind, e.ID, e.Status)
+	if e.Step != "" {
+		msg += " at " + e.Step
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// DeviceTrustRequest identifies the BIG-IP to trust.
+type DeviceTrustRequest struct {
+	Address      string `json:"address"`
+	Port         int    `json:"port,omitempty"`
+	User         string `json:"userName"`
+	Password     string `json:"password"`
+	ClusterName  string `json:"clusterName"`
+	UseBigIQSync bool   `json:"useBigiqSync"`
+	Name         string `json:"name,omitempty"`
+}
+
+// DeviceTaskOptions controls how device tasks are waited for.
+type DeviceTaskOptions struct {
+	// PollInterval is the delay between status polls. Defaults to 5 seconds.
+	PollInterval time.Duration
+	// ConfirmFrameworkUpgrade lets BIG-IQ upgrade the REST framework of the
+	// device when trust requires it. Otherwise trust fails.
+	ConfirmFrameworkUpgrade bool
+	// ConflictPolicy resolves import conflicts. Defaults to ConflictAbort.
+	ConflictPolicy ConflictPolicy
+}
+
+type deviceTaskPatch struct {
+	Status                  DeviceTaskStatus `json:"status"`
+	ConfirmFrameworkUpgrade bool             `json:"confirmFrameworkUpgrade,omitempty"`
+	AcceptConflicts         bool             `json:"acceptConflicts,omitempty"`
+	Conflicts               []ImportConflict `json:"conflicts,omitempty"`
+}
+
+type moduleRef struct {
+	Module DeviceModule `json:"module"`
+}
+
+type discoveryRequest struct {
+	DeviceReference DeviceRef        `json:"deviceReference"`
+	ModuleList      []moduleRef      `json:"moduleList"`
+	Status          DeviceTaskStatus `json:"status"`
+}
+
+type importRequest struct {
+	Name                  string    `json:"name"`
+	DeviceReference       DeviceRef `json:"deviceReference"`
+	CreateChildTasks      bool      `json:"createChildTasks"`
+	SkipDiscovery         bool      `json:"skipDiscovery"`
+	SnapshotWorkingConfig bool      `json:"snapshotWorkingConfig"`
+	UseBigIQSync          bool      `json:"useBigiqSync"`
+}
+
+// machineLink is the device reference BIG-IQ tasks take for a trusted device.
+func machineLink(machineID string) DeviceRef {
+	return DeviceRef{Link: "https://localhost/" + strings.Join([]string{uriMgmt, uriCm, uriSystem, uriMachineResolver, machineID}, "/")}
+}
+
+func (b *BigIQ) startDeviceTask(kind string, body interface{}, collection ...string) (*DeviceTask, error) {
+	resp, err := b.postReq(body, collection...)
+	if err != nil {
+		return nil, err
+	}
+	var task DeviceTask
+	if err := json.Unmarshal(resp, &task); err != nil {
+		return nil, err
+	}
+	if task.ID == "" {
+		return nil, fmt.Errorf("device %s task response has no id: %s", kind, resp)
+	}
+	task.kind = kind
+	task.collection = collection
+	return &task, nil
+}
+
+// StartDeviceTrust starts establishing trust between BIG-IQ and the BIG-IP at
+// req.Address. Wait for it with WaitForDeviceTask; the finished task carries
+// the machine ID used by discovery and import.
+func (b *BigIQ) StartDeviceTrust(req DeviceTrustRequest) (*DeviceTask, error) {
+	if req.Name == "" {
+		req.Name = "trust_" + req.Address
+	}
+	return b.startDeviceTask("trust", req, uriMgmt, uriCm, uriGlobal, uriTasks, uriDeviceTrust)
+}
+
+// StartDeviceDiscovery starts discovering the given modules of a trusted
+// device. LTM is always discovered.
+func (b *BigIQ) StartDeviceDiscovery(machineID string, modules []DeviceModule) (*DeviceTask, error) {
+	body := discoveryRequest{DeviceReference: machineLink(machineID), Status: DeviceTaskStarted}
+	for _, m := range withSharedModules(modules) {
+		body.ModuleList = append(body.ModuleList, moduleRef{Module: m})
+	}
+	return b.startDeviceTask("discovery", body, uriMgmt, uriCm, uriGlobal, uriTasks, uriDeviceDiscovery)
+}
+
+// StartDeviceImport starts importing the discovered configuration of one
+// module of a device.
+func (b *BigIQ) StartDeviceImport(machineID string, module DeviceModule) (*DeviceTask, error) {
+	body := importRequest{
+		Name:            fmt.Sprintf("import_%s_%s", machineID, module),
+		DeviceReference: machineLink(machineID),
+		SkipDiscovery:   true,
+	}
+	return b.startDeviceTask("import", body, uriMgmt, uriCm, module.importPath(), uriTasks, uriDeclareMgmt)
+}
+
+// WaitForDeviceTask polls a task returned by StartDeviceTrust,
+// StartDeviceDiscovery or StartDeviceImport until it finishes, confirming
+// framework upgrades and resolving import conflicts as opts allow. Failed,
+// cancelled or unresolved tasks return a *DeviceTaskError.
+func (b *BigIQ) WaitForDeviceTask(ctx context.Context, task *DeviceTask, opts DeviceTaskOptions) (*DeviceTask, error) {
+	if task.collection == nil {
+		return nil, fmt.Errorf("device task %s was not started by this session", task.ID)
+	}
+	interval := opts.PollInterval
+	if interval <= 0 {
+		interval = defaultOnboardPollInterval
+	}
+	path := append(append([]string{}, task.collection...), task.ID)
+	current := task
+	err := b.pollTask(ctx, TaskDevice, interval, func() (bool, error) {
+		var latest DeviceTask
+		err, ok := b.getForEntity(&latest, path...)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			return false, fmt.Errorf("device %s task %s not found", task.kind, task.ID)
+		}
+		latest.kind, latest.collection = task.kind, task.collection
+		current = &latest
+		switch {
+		case latest.Status == DeviceTaskPendingUpgrade:
+			if !opts.ConfirmFrameworkUpgrade {
+				return false, latest.err("framework upgrade not confirmed")
+			}
+			return false, b.patch(deviceTaskPatch{Status: DeviceTaskStarted, ConfirmFrameworkUpgrade: true}, path...)
+		case latest.pendingConflicts():
+			if opts.ConflictPolicy == "" || opts.ConflictPolicy == ConflictAbort {
+				return false, latest.err(fmt.Sprintf("%d unresolved conflicts", len(latest.Conflicts)))
+			}
+			for i := range latest.Conflicts {
+				latest.Conflicts[i].Resolution = string(opts.ConflictPolicy)
+			}
+			return false, b.patch(deviceTaskPatch{Status: DeviceTaskStarted, AcceptConflicts: true, Conflicts: latest.Conflicts}, path...)
+		case latest.Status == DeviceTaskFinished:
+			return true, nil
+		case latest.Status.Done():
+			return false, latest.err(latest.ErrorMessage)
+		}
+		return false, nil
+	})
+	return current, err
+}
+
+func (t *DeviceTask) err(message string) *DeviceTaskError {
+	return &DeviceTaskError{Kind: t.kind, ID: t.ID, Status: t.Status, Step: t.CurrentStep, Message: message}
+}
+
+// OnboardRequest describes a BIG-IP to bring under BIG-IQ management.
+type OnboardRequest struct {
+	Trust   DeviceTrustRequest
+	Modules []DeviceModule
+	DeviceTaskOptions
+}
+
+// OnboardResult holds the tasks run by OnboardDevice, up to the one that
+// failed.
+type OnboardResult struct {
+	MachineID string
+	Trust     *DeviceTask
+	Discovery *DeviceTask
+	Imports   []*DeviceTask
+}
+
+// OnboardDevice establishes trust with a BIG-IP, discovers the requested
+// modules and imports their configuration, one module at a time, resolving
+// conflicts with req.ConflictPolicy.
+func (b *BigIQ) OnboardDevice(ctx context.Context, req OnboardRequest) (*OnboardResult, error) {
+	result := &OnboardResult{}
+	task, err := b.StartDeviceTrust(req.Trust)
+	if err != nil {
+		return result, err
+	}
+	result.Trust, err = b.WaitForDeviceTask(ctx, task, req.DeviceTaskOptions)
+	// The managed devices change when the task finishes, not when it starts.
+	b.invalidateManagedDevices()
+	if err != nil {
+		return result, err
+	}
+	result.MachineID = result.Trust.MachineID
+	if result.MachineID == "" {
+		return result, fmt.Errorf("device trust of %s finished without a machine ID", req.Trust.Address)
+	}
+
+	task, err = b.StartDeviceDiscovery(result.MachineID, req.Modules)
+	if err != nil {
+		return result, err
+	}
+	result.Discovery, err = b.WaitForDeviceTask(ctx, task, req.DeviceTaskOptions)
+	if err != nil {
+		return result, err
+	}
+
+	for _, module := range withSharedModules(req.Modules) {
+		task, err = b.StartDeviceImport(result.MachineID, module)
+		if err != nil {
+			return result, err
+		}
+		task, err = b.WaitForDeviceTask(ctx, task, req.DeviceTaskOptions)
+		b.invalidateManagedDevices()
+		result.Imports = append(result.Imports, task)
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
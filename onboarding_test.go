@@ -0,0 +1,140 @@
+package bigiq
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOnboardDeviceResolvesConflicts(t *testing.T) {
+	var discovered []moduleRef
+	var imported []string
+	var resolutions []string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		path := r.URL.Path
+		switch {
+		case r.Method == http.MethodPost && strings.HasSuffix(path, "/device-trust"):
+			w.Write([]byte(`{"id":"trust-1","status":"STARTED"}`))
+		case strings.HasSuffix(path, "/device-trust/trust-1"):
+			w.Write([]byte(`{"id":"trust-1","status":"FINISHED","machineId":"m-1"}`))
+		case r.Method == http.MethodPost && strings.HasSuffix(path, "/device-discovery"):
+			var body discoveryRequest
+			json.NewDecoder(r.Body).Decode(&body)
+			discovered = body.ModuleList
+			assert.True(t, strings.HasSuffix(body.DeviceReference.Link, "/mgmt/cm/system/machineid-resolver/m-1"))
+			w.Write([]byte(`{"id":"disc-1","status":"STARTED"}`))
+		case strings.HasSuffix(path, "/device-discovery/disc-1"):
+			w.Write([]byte(`{"id":"disc-1","status":"FINISHED"}`))
+		case r.Method == http.MethodPost && strings.HasSuffix(path, "/declare-mgmt-authority"):
+			module := strings.Split(path, "/")[3]
+			imported = append(imported, module)
+			w.Write([]byte(`{"id":"` + module + `","status":"STARTED"}`))
+		case r.Method == http.MethodPatch:
+			var body deviceTaskPatch
+			json.NewDecoder(r.Body).Decode(&body)
+			resolutions = append(resolutions, body.Conflicts[0].Resolution)
+			w.Write([]byte(`{}`))
+		case strings.HasSuffix(path, "/adc-core/tasks/declare-mgmt-authority/adc-core") && len(resolutions) == 0:
+			w.Write([]byte(`{"id":"adc-core","status":"STARTED","currentStep":"PENDING_CONFLICTS",
+				"conflicts":[{"fromReference":{"link":"a"},"toReference":{"link":"b"}}]}`))
+		default:
+			w.Write([]byte(`{"id":"x","status":"FINISHED"}`))
+		}
+	}))
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+
+	result, err := b.OnboardDevice(context.Background(), OnboardRequest{
+		Trust:   DeviceTrustRequest{Address: "10.0.0.5", User: "admin", Password: "secret"},
+		Modules: []DeviceModule{ModuleASM},
+		DeviceTaskOptions: DeviceTaskOptions{
+			PollInterval:   time.Millisecond,
+			ConflictPolicy: ConflictUseBigIP,
+		},
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "m-1", result.MachineID)
+	assert.Equal(t, []moduleRef{{ModuleLTM}, {ModuleSecurityShared}, {ModuleASM}}, discovered)
+	assert.Equal(t, []string{"adc-core", "security-shared", "asm"}, imported)
+	assert.Equal(t, []string{"USE_BIGIP"}, resolutions)
+	assert.Equal(t, 3, len(result.Imports))
+}
+
+func TestOnboardDeviceRefreshesCachedManagedDevices(t *testing.T) {
+	var b *BigIQ
+	var importPolls int
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		path := r.URL.Path
+		switch {
+		case strings.HasSuffix(path, "/cm-bigip-allBigIpDevices/devices"):
+			if importPolls > 1 {
+				w.Write([]byte(`{"items":[{"address":"10.0.0.5","selfLink":"https://localhost/mgmt/shared/resolver/device-groups/cm-bigip-allBigIpDevices/devices/d-1"}]}`))
+				return
+			}
+			w.Write([]byte(`{"items":[]}`))
+		case r.Method == http.MethodPost && strings.HasSuffix(path, "/device-trust"):
+			w.Write([]byte(`{"id":"trust-1","status":"STARTED"}`))
+		case strings.HasSuffix(path, "/device-trust/trust-1"):
+			w.Write([]byte(`{"id":"trust-1","status":"FINISHED","machineId":"m-1"}`))
+		case r.Method == http.MethodPost:
+			w.Write([]byte(`{"id":"task-1","status":"STARTED"}`))
+		case strings.HasSuffix(path, "/declare-mgmt-authority/task-1"):
+			importPolls++
+			if importPolls == 1 {
+				// Someone looks the device up while it is being imported.
+				id, err := b.GetDeviceId("10.0.0.5")
+				assert.Nil(t, err)
+				assert.Equal(t, "", id)
+				w.Write([]byte(`{"id":"task-1","status":"STARTED"}`))
+				return
+			}
+			w.Write([]byte(`{"id":"task-1","status":"FINISHED"}`))
+		default:
+			w.Write([]byte(`{"id":"task-1","status":"FINISHED"}`))
+		}
+	}))
+	defer server.Close()
+	b = NewSession(server.URL, "", "", "", &ConfigOptions{APICallTimeout: 5 * time.Second, CacheTTL: time.Minute})
+
+	_, err := b.OnboardDevice(context.Background(), OnboardRequest{
+		Trust:             DeviceTrustRequest{Address: "10.0.0.5", User: "admin", Password: "secret"},
+		DeviceTaskOptions: DeviceTaskOptions{PollInterval: time.Millisecond},
+	})
+	assert.Nil(t, err)
+
+	id, err := b.GetDeviceId("10.0.0.5")
+	assert.Nil(t, err)
+	assert.True(t, strings.HasSuffix(id, "/devices/d-1"))
+}
+
+func TestWaitForDeviceTaskAbortsOnConflicts(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodPost {
+			w.Write([]byte(`{"id":"imp-1","status":"STARTED"}`))
+			return
+		}
+		w.Write([]byte(`{"id":"imp-1","status":"PENDING_CONFLICTS","conflicts":[{},{}]}`))
+	}))
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+
+	task, err := b.StartDeviceImport("m-1", ModuleLTM)
+	assert.Nil(t, err)
+	_, err = b.WaitForDeviceTask(context.Background(), task, DeviceTaskOptions{PollInterval: time.Millisecond})
+
+	taskErr, ok := err.(*DeviceTaskError)
+	assert.True(t, ok)
+	assert.Equal(t, DeviceTaskPendingConflicts, taskErr.Status)
+	assert.Equal(t, "import", taskErr.Kind)
+	assert.Contains(t, taskErr.Error(), "2 unresolved conflicts")
+}
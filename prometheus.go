@@ -0,0 +1,235 @@
+package bigiq
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultDurationBuckets are the histogram buckets, in seconds, used by
+// PrometheusMetrics when none are given.
+var DefaultDurationBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// PrometheusMetrics is a Metrics implementation that keeps counters and
+// histograms in memory and serves them in the Prometheus text exposition
+// format. It implements http.Handler so it can be mounted directly on a
+// /metrics endpoint, or written out with WriteTo.
+type PrometheusMetrics struct {
+	// Namespace prefixes every metric name. Defaults to "bigiq".
+	Namespace string
+	// Buckets are the upper bounds, in seconds, of the duration histograms.
+	Buckets []float64
+
+	mu              sync.Mutex
+	requests        map[string]float64
+	requestDuration map[string]*histogram
+	retries         map[string]float64
+	tokenRefreshes  float64
+	taskPolls       map[string]float64
+	taskDuration    map[string]*histogram
+	uploadBytes     float64
+	uploadDuration  *histogram
+	uploadRate      float64
+}
+
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, upper := range h.buckets {
+		if v <= upper {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// NewPrometheusMetrics returns an empty PrometheusMetrics using the default
+// namespace and buckets.
+func NewPrometheusMetrics() *PrometheusMetrics {
+	return &PrometheusMetrics{}
+}
+
+func (p *PrometheusMetrics) init() {
+	if p.requests != nil {
+		return
+	}
+	if p.Namespace == "" {
+		p.Namespace = "bigiq"
+	}
+	if len(p.Buckets) == 0 {
+		p.Buckets = DefaultDurationBuckets
+	}
+	p.requests = make(map[string]float64)
+	p.requestDuration = make(map[string]*histogram)
+	p.retries = make(map[string]float64)
+	p.taskPolls = make(map[string]float64)
+	p.taskDuration = make(map[string]*histogram)
+	p.uploadDuration = newHistogram(p.Buckets)
+}
+
+// ObserveRequest implements Metrics.
+func (p *PrometheusMetrics) ObserveRequest(method, path string, status int, duration time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.init()
+	p.requests[labels("method", method, "path", path, "status", strconv.Itoa(status))]++
+	key := labels("method", method, "path", path)
+	h, ok := p.requestDuration[key]
+	if !ok {
+		h = newHistogram(p.Buckets)
+		p.requestDuration[key] = h
+	}
+	h.observe(duration.Seconds())
+}
+
+// IncRetry implements Metrics.
+func (p *PrometheusMetrics) IncRetry(operation string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.init()
+	p.retries[labels("operation", operation)]++
+}
+
+// IncTokenRefresh implements Metrics.
+func (p *PrometheusMetrics) IncTokenRefresh() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.init()
+	p.tokenRefreshes++
+}
+
+// ObserveTaskPoll implements Metrics.
+func (p *PrometheusMetrics) ObserveTaskPoll(task string, iterations int, duration time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.init()
+	key := labels("task", task)
+	p.taskPolls[key] += float64(iterations)
+	h, ok := p.taskDuration[key]
+	if !ok {
+		h = newHistogram(p.Buckets)
+		p.taskDuration[key] = h
+	}
+	h.observe(duration.Seconds())
+}
+
+// ObserveUpload implements Metrics.
+func (p *PrometheusMetrics) ObserveUpload(bytes int64, duration time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.init()
+	p.uploadBytes += float64(bytes)
+	p.uploadDuration.observe(duration.Seconds())
+	if duration > 0 {
+		p.uploadRate = float64(bytes) / duration.Seconds()
+	}
+}
+
+// ServeHTTP writes the current metrics in the Prometheus text format.
+func (p *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	p.WriteTo(w)
+}
+
+// WriteTo writes the current metrics in the Prometheus text format.
+func (p *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.init()
+	var sb strings.Builder
+	p.writeCounter(&sb, "api_requests_total", "BIG-IQ API requests by method, path template and status.", p.requests)
+	p.writeHistograms(&sb, "api_request_duration_seconds", "BIG-IQ API request latency.", p.requestDuration)
+	p.writeCounter(&sb, "retries_total", "Operations retried by the client.", p.retries)
+	p.writeCounter(&sb, "token_refreshes_total", "Authentication tokens re-acquired after being rejected.", map[string]float64{"": p.tokenRefreshes})
+	p.writeCounter(&sb, "task_poll_iterations_total", "Status polls issued while waiting on asynchronous tasks.", p.taskPolls)
+	p.writeHistograms(&sb, "task_duration_seconds", "Time spent waiting on asynchronous tasks.", p.taskDuration)
+	p.writeCounter(&sb, "upload_bytes_total", "Bytes uploaded to BIG-IQ.", map[string]float64{"": p.uploadBytes})
+	p.writeHistograms(&sb, "upload_duration_seconds", "File upload duration.", map[string]*histogram{"": p.uploadDuration})
+	p.writeSeries(&sb, "upload_throughput_bytes_per_second", "gauge", "Throughput of the most recent upload.", map[string]float64{"": p.uploadRate})
+	n, err := io.WriteString(w, sb.String())
+	return int64(n), err
+}
+
+func (p *PrometheusMetrics) writeCounter(sb *strings.Builder, name, help string, series map[string]float64) {
+	p.writeSeries(sb, name, "counter", help, series)
+}
+
+func (p *PrometheusMetrics) writeSeries(sb *strings.Builder, name, kind, help string, series map[string]float64) {
+	name = p.Namespace + "_" + name
+	fmt.Fprintf(sb, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	for _, key := range sortedKeys(series) {
+		fmt.Fprintf(sb, "%s%s %s\n", name, braces(key), formatFloat(series[key]))
+	}
+}
+
+func (p *PrometheusMetrics) writeHistograms(sb *strings.Builder, name, help string, series map[string]*histogram) {
+	name = p.Namespace + "_" + name
+	fmt.Fprintf(sb, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	keys := make([]string, 0, len(series))
+	for k := range series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		h := series[key]
+		for i, upper := range h.buckets {
+			le := labels("le", formatFloat(upper))
+			fmt.Fprintf(sb, "%s_bucket%s %d\n", name, braces(joinLabels(key, le)), h.counts[i])
+		}
+		fmt.Fprintf(sb, "%s_bucket%s %d\n", name, braces(joinLabels(key, `le="+Inf"`)), h.count)
+		fmt.Fprintf(sb, "%s_sum%s %s\n", name, braces(key), formatFloat(h.sum))
+		fmt.Fprintf(sb, "%s_count%s %d\n", name, braces(key), h.count)
+	}
+}
+
+// labels renders name/value pairs as a Prometheus label list without braces.
+func labels(pairs ...string) string {
+	parts := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(pairs[i+1])
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, pairs[i], v))
+	}
+	return strings.Join(parts, ",")
+}
+
+func joinLabels(a, b string) string {
+	if a == "" {
+		return b
+	}
+	return a + "," + b
+}
+
+func braces(l string) string {
+	if l == "" {
+		return ""
+	}
+	return "{" + l + "}"
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
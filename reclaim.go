@@ -0,0 +1,129 @@
+package bigiq
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"time"
+)
+
+// ReclaimOptions controls ReclaimOrphanedLicenses.
+type ReclaimOptions struct {
+	// DryRun reports the orphan candidates without revoking anything.
+	DryRun bool
+	// MinAge skips memberships that BIG-IQ changed less than MinAge ago, so
+	// devices that are still booting are left alone. Memberships without a
+	// recorded change time are treated as old enough.
+	MinAge time.Duration
+	// Allow, when not empty, limits reclamation to devices whose address,
+	// name or pool name matches one of the patterns (path.Match syntax).
+	Allow []string
+	// Deny protects devices whose address, name or pool name matches one of
+	// the patterns. Deny wins over Allow.
+	Deny []string
+	// Probe, if set, is asked about every device BIG-IQ does not manage and
+	// returns true if the device is still alive.
+	Probe func(ctx context.Context, assignment LicenseAssignment) bool
+}
+
+// ReclaimCandidate is a license membership whose device looks gone. Age is
+// zero if BIG-IQ did not record when the membership changed.
+type ReclaimCandidate struct {
+	Assignment LicenseAssignment
+	Age        time.Duration
+	Revoked    bool
+	Err        error
+}
+
+// ReclaimReport is the outcome of ReclaimOrphanedLicenses.
+type ReclaimReport struct {
+	Checked    int
+	Candidates []ReclaimCandidate
+}
+
+// matchesAny reports whether the address, name or pool of the assignment
+// matches one of patterns.
+func (a *LicenseAssignment) matchesAny(patterns []string) bool {
+	for _, pattern := range patterns {
+		for _, value := range []string{a.DeviceAddress, a.DeviceName, a.PoolName} {
+			if ok, _ := path.Match(pattern, value); ok && value != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ReclaimOrphanedLicenses finds license memberships, in any pool, whose
+// device is neither managed by BIG-IQ nor alive according to opts.Probe, and
+// unless opts.DryRun is set revokes them as unreachable devices. Revocation
+// failures are recorded on the candidate and do not stop the run.
+func (b *BigIQ) ReclaimOrphanedLicenses(ctx context.Context, opts ReclaimOptions) (*ReclaimReport, error) {
+	assignments, err := b.LicenseAssignments()
+	if err != nil {
+		return nil, err
+	}
+	devices, err := b.GetManagedDevices()
+	if err != nil {
+		return nil, err
+	}
+	managed := make(map[string]bool)
+	for _, d := range devices.DevicesInfo {
+		for _, key := range []string{d.Address, d.ManagementAddress, d.MachineID} {
+			if key != "" {
+				managed[key] = true
+			}
+		}
+	}
+
+	report := &ReclaimReport{}
+	now := time.Now()
+	for _, a := range assignments {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		report.Checked++
+		if managed[a.DeviceAddress] || managed[a.DeviceMachineID] {
+			continue
+		}
+		if a.matchesAny(opts.Deny) || (len(opts.Allow) > 0 && !a.matchesAny(opts.Allow)) {
+			continue
+		}
+		var age time.Duration
+		if !a.LastUpdate.IsZero() {
+			age = now.Sub(a.LastUpdate)
+			if age < opts.MinAge {
+				continue
+			}
+		}
+		if opts.Probe != nil && opts.Probe(ctx, a) {
+			continue
+		}
+		candidate := ReclaimCandidate{Assignment: a, Age: age}
+		if !opts.DryRun {
+			candidate.Err = b.revokeUnreachable(ctx, &a)
+			candidate.Revoked = candidate.Err == nil
+			if candidate.Err != nil {
+				log.Printf("[ERROR] reclaiming license of %s from pool %s: %v", a.DeviceAddress, a.PoolName, candidate.Err)
+			}
+		}
+		report.Candidates = append(report.Candidates, candidate)
+	}
+	return report, nil
+}
+
+// revokeUnreachable revokes the assignment of a device that can no longer be
+// contacted. BIG-IQ identifies such devices by MAC address.
+func (b *BigIQ) revokeUnreachable(ctx context.Context, a *LicenseAssignment) error {
+	if a.MacAddress == "" {
+		return fmt.Errorf("no MAC address recorded for %s; cannot revoke as unreachable", a.DeviceAddress)
+	}
+	return b.runLicenseTask(ctx, &LicenseParam{
+		Command:         LicenseRevoke,
+		Address:         a.DeviceAddress,
+		AssignmentType:  AssignmentUnreachable,
+		LicensePoolName: a.PoolName,
+		MacAddress:      a.MacAddress,
+	})
+}
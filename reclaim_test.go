@@ -0,0 +1,101 @@
+package bigiq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReclaimOrphanedLicensesDryRun(t *testing.T) {
+	old := time.Now().Add(-48 * time.Hour).UnixMicro()
+	young := time.Now().Add(-time.Minute).UnixMicro()
+	posts := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		path := r.URL.Path
+		switch {
+		case r.Method == http.MethodPost:
+			posts++
+		case strings.HasSuffix(path, "/cm-bigip-allBigIpDevices/devices"):
+			w.Write([]byte(`{"items":[{"address":"10.0.0.1","machineId":"mid-1"}]}`))
+		case strings.HasSuffix(path, "/purchased-pool/licenses"):
+			w.Write([]byte(`{"items":[{"uuid":"pp-1","name":"pp"}]}`))
+		case strings.HasSuffix(path, "/pp-1/members"):
+			fmt.Fprintf(w, `{"items":[
+				{"id":"managed","deviceAddress":"10.0.0.1","lastUpdateMicros":%d},
+				{"id":"orphan","deviceAddress":"10.0.0.2","macAddress":"aa","lastUpdateMicros":%d},
+				{"id":"young","deviceAddress":"10.0.0.3","lastUpdateMicros":%d},
+				{"id":"denied","deviceAddress":"192.168.0.4","lastUpdateMicros":%d},
+				{"id":"alive","deviceAddress":"10.0.0.5","lastUpdateMicros":%d}]}`, old, old, young, old, old)
+		default:
+			w.Write([]byte(`{"items":[]}`))
+		}
+	}))
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+
+	report, err := b.ReclaimOrphanedLicenses(context.Background(), ReclaimOptions{
+		DryRun: true,
+		MinAge: time.Hour,
+		Deny:   []string{"192.168.*"},
+		Probe: func(ctx context.Context, a LicenseAssignment) bool {
+			return a.DeviceAddress == "10.0.0.5"
+		},
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 5, report.Checked)
+	assert.Len(t, report.Candidates, 1)
+	assert.Equal(t, "orphan", report.Candidates[0].Assignment.MemberID)
+	assert.False(t, report.Candidates[0].Revoked)
+	assert.Equal(t, 0, posts)
+}
+
+func TestReclaimOrphanedLicensesRevokes(t *testing.T) {
+	var revoked []LicenseParam
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		path := r.URL.Path
+		switch {
+		case r.Method == http.MethodPost:
+			var config LicenseParam
+			json.NewDecoder(r.Body).Decode(&config)
+			revoked = append(revoked, config)
+			w.Write([]byte(`{"id":"task-1"}`))
+		case strings.HasSuffix(path, "/member-management/task-1"):
+			w.Write([]byte(`{"id":"task-1","status":"FINISHED"}`))
+		case strings.HasSuffix(path, "/purchased-pool/licenses"):
+			w.Write([]byte(`{"items":[{"uuid":"pp-1","name":"pp"}]}`))
+		case strings.HasSuffix(path, "/pp-1/members"):
+			// Neither member records when it last changed.
+			w.Write([]byte(`{"items":[
+				{"id":"orphan","deviceAddress":"10.0.0.2","macAddress":"00:11:22:33:44:55"},
+				{"id":"nomac","deviceAddress":"10.0.0.3"}]}`))
+		default:
+			w.Write([]byte(`{"items":[]}`))
+		}
+	}))
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+
+	report, err := b.ReclaimOrphanedLicenses(context.Background(), ReclaimOptions{MinAge: time.Hour})
+
+	assert.Nil(t, err)
+	assert.Len(t, report.Candidates, 2)
+	assert.True(t, report.Candidates[0].Revoked)
+	assert.Nil(t, report.Candidates[0].Err)
+	assert.False(t, report.Candidates[1].Revoked)
+	assert.Contains(t, report.Candidates[1].Err.Error(), "no MAC address recorded for 10.0.0.3")
+	assert.Len(t, revoked, 1)
+	assert.Equal(t, LicenseRevoke, revoked[0].Command)
+	assert.Equal(t, AssignmentUnreachable, revoked[0].AssignmentType)
+	assert.Equal(t, "pp", revoked[0].LicensePoolName)
+	assert.Equal(t, "00:11:22:33:44:55", revoked[0].MacAddress)
+}
@@ -0,0 +1,252 @@
+package bigiq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// RegKeyLicenseState carries the license term of an activated offering.
+type RegKeyLicenseState struct {
+	LicenseStartDateTime string `json:"licenseStartDateTime,omitempty"`
+	LicenseEndDateTime   string `json:"licenseEndDateTime,omitempty"`
+}
+
+// RegKeyOffering is a registration key in a regkey pool, together with its
+// activation state.
+type RegKeyOffering struct {
+	Activation
+	LicenseState RegKeyLicenseState `json:"licenseState,omitempty"`
+	// Members is the number of devices licensed with the key. It is only
+	// filled in by RegKeyOfferings.
+	Members int `json:"-"`
+}
+
+// Expires returns the end of the license term, if BIG-IQ reports one.
+func (o *RegKeyOffering) Expires() (time.Time, bool) {
+	return parseLicenseDate(o.LicenseState.LicenseEndDateTime)
+}
+
+type regKeyOfferings struct {
+	Items []RegKeyOffering `json:"items"`
+}
+
+// regKeyOfferingRequest is the body that adds a key to a pool.
+type regKeyOfferingRequest struct {
+	RegKey      string           `json:"regKey"`
+	Description string           `json:"description,omitempty"`
+	Status      ActivationStatus `json:"status"`
+}
+
+// RegKeyOfferingResult is the outcome for one key of AddRegKeyOfferings.
+type RegKeyOfferingResult struct {
+	RegKey   string
+	Offering *Activation
+	Err      error
+}
+
+func offeringPath(poolID string, parts ...string) []string {
+	return append([]string{uriMgmt, uriCm, uriDevice, uriLicensing, uriPool, uriRegkey, uriLicenses, poolID, uriOfferings}, parts...)
+}
+
+// regkeyPoolID resolves the name of a regkey pool to its ID.
+func (b *BigIQ) regkeyPoolID(pool string) (string, error) {
+	poolID, err := b.GetRegkeyPoolId(pool)
+	if err != nil {
+		return "", err
+	}
+	if poolID == "" {
+		return "", fmt.Errorf("regkey pool %s not found", pool)
+	}
+	return poolID, nil
+}
+
+// AddRegKeyOffering adds regkey to the named regkey pool and starts its
+// activation with status ActivationAutomatic or ActivationManual.
+func (b *BigIQ) AddRegKeyOffering(pool, regkey, description string, status ActivationStatus) (*Activation, error) {
+	poolID, err := b.regkeyPoolID(pool)
+	if err != nil {
+		return nil, err
+	}
+	body := regKeyOfferingRequest{
+		RegKey:      regkey,
+		Description: description,
+		Status:      status,
+	}
+	resp, err := b.postReq(body, offeringPath(poolID)...)
+	if err != nil {
+		return nil, err
+	}
+	var activation Activation
+	if err := json.Unmarshal(resp, &activation); err != nil {
+		return nil, err
+	}
+	return &activation, nil
+}
+
+// ActivateRegKeyOffering adds opts.RegKey to the named regkey pool and drives
+// its automatic activation until the offering is READY, in the same way as
+// ActivateRegKey.
+// With opts.CleanupOnFailure the offering is removed again if the activation
+// fails.
+func (b *BigIQ) ActivateRegKeyOffering(ctx context.Context, pool string, opts ActivationOptions) (*Activation, error) {
+	poolID, err := b.regkeyPoolID(pool)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := b.AddRegKeyOffering(pool, opts.RegKey, opts.Name, ActivationAutomatic); err != nil {
+		return nil, err
+	}
+	path := offeringPath(poolID, opts.RegKey)
+	return b.driveActivation(ctx, opts, path, func() (*Activation, error) {
+		return b.patchActivationAt(opts.RegKey, regKeyOfferingRequest{RegKey: opts.RegKey, Status: ActivationAutomatic}, path)
+	}, func() error {
+		_, err := b.deleteReq(path...)
+		return err
+	})
+}
+
+// AddRegKeyOfferings adds and automatically activates each of regkeys in the
+// named regkey pool, one after the other. opts.RegKey is ignored; opts.Name
+// is used as the description of every key. A failed key does not stop the
+// others; check the Err of each result.
+func (b *BigIQ) AddRegKeyOfferings(ctx context.Context, pool string, regkeys []string, opts ActivationOptions) []RegKeyOfferingResult {
+	results := make([]RegKeyOfferingResult, 0, len(regkeys))
+	for _, regkey := range regkeys {
+		keyOpts := opts
+		keyOpts.RegKey = regkey
+		activation, err := b.ActivateRegKeyOffering(ctx, pool, keyOpts)
+		if err != nil {
+			log.Printf("[ERROR] activation of REG-KEY %s in pool %s failed: %v", regkey, pool, err)
+		}
+		results = append(results, RegKeyOfferingResult{RegKey: regkey, Offering: activation, Err: err})
+	}
+	return results
+}
+
+// GetRegKeyOffering returns the state of regkey in the named regkey pool.
+func (b *BigIQ) GetRegKeyOffering(pool, regkey string) (*RegKeyOffering, error) {
+	poolID, err := b.regkeyPoolID(pool)
+	if err != nil {
+		return nil, err
+	}
+	var offering RegKeyOffering
+	err, ok := b.getForEntity(&offering, offeringPath(poolID, regkey)...)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("REG-KEY %s not found in pool %s", regkey, pool)
+	}
+	return &offering, nil
+}
+
+// RegKeyOfferings returns the keys of the named regkey pool with their
+// status, license term and member count.
+func (b *BigIQ) RegKeyOfferings(pool string) ([]RegKeyOffering, error) {
+	poolID, err := b.regkeyPoolID(pool)
+	if err != nil {
+		return nil, err
+	}
+	var offerings regKeyOfferings
+	err, _ = b.getForEntity(&offerings, offeringPath(poolID)...)
+	if err != nil {
+		return nil, err
+	}
+	for i := range offerings.Items {
+		count, err := b.offeringMemberCount(poolID, offerings.Items[i].RegKey)
+		if err != nil {
+			return nil, err
+		}
+		offerings.Items[i].Members = count
+	}
+	return offerings.Items, nil
+}
+
+func (b *BigIQ) offeringMembers(poolID, regkey string) ([]LicenseMember, error) {
+	var members struct {
+		Items []LicenseMember `json:"items"`
+	}
+	err, _ := b.getForEntity(&members, offeringPath(poolID, regkey, uriMembers)...)
+	if err != nil {
+		return nil, err
+	}
+	return members.Items, nil
+}
+
+func (b *BigIQ) offeringMemberCount(poolID, regkey string) (int, error) {
+	members, err := b.offeringMembers(poolID, regkey)
+	return len(members), err
+}
+
+// StartManualOfferingActivation adds regkey to the named regkey pool for an
+// offline (manual) activation. Continue with WaitForOfferingDossier and
+// CompleteManualOfferingActivation, as for StartManualActivation.
+func (b *BigIQ) StartManualOfferingActivation(pool, regkey, description string) (*Activation, error) {
+	return b.AddRegKeyOffering(pool, regkey, description, ActivationManual)
+}
+
+// WaitForOfferingDossier waits for a manual offering activation to produce
+// its dossier and returns it.
+func (b *BigIQ) WaitForOfferingDossier(ctx context.Context, pool, regkey string) (string, error) {
+	poolID, err := b.regkeyPoolID(pool)
+	if err != nil {
+		return "", err
+	}
+	return b.waitForDossierAt(ctx, regkey, offeringPath(poolID, regkey))
+}
+
+// CompleteManualOfferingActivation provides the license text for a manual
+// offering activation and waits until the key is activated.
+func (b *BigIQ) CompleteManualOfferingActivation(ctx context.Context, pool, regkey, licenseText string) error {
+	poolID, err := b.regkeyPoolID(pool)
+	if err != nil {
+		return err
+	}
+	return b.completeManualActivationAt(ctx, regkey, licenseText, offeringPath(poolID, regkey))
+}
+
+// RemoveRegKeyOffering removes regkey from the named regkey pool. Keys that
+// still license devices are refused; revoke their members first.
+func (b *BigIQ) RemoveRegKeyOffering(pool, regkey string) error {
+	poolID, err := b.regkeyPoolID(pool)
+	if err != nil {
+		return err
+	}
+	count, err := b.offeringMemberCount(poolID, regkey)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("REG-KEY %s in pool %s still licenses %d devices", regkey, pool, count)
+	}
+	return b.delete(offeringPath(poolID, regkey)...)
+}
+
+// PruneRegKeyOfferings removes every key of the named regkey pool that
+// licenses no devices and whose activation has finished (READY or
+// ACTIVATION_FAILED), and returns the removed keys. Keys still being
+// activated are left alone.
+func (b *BigIQ) PruneRegKeyOfferings(pool string) ([]string, error) {
+	offerings, err := b.RegKeyOfferings(pool)
+	if err != nil {
+		return nil, err
+	}
+	poolID, err := b.regkeyPoolID(pool)
+	if err != nil {
+		return nil, err
+	}
+	var removed []string
+	for _, o := range offerings {
+		if o.Members > 0 || !o.Status.Done() {
+			continue
+		}
+		if err := b.delete(offeringPath(poolID, o.RegKey)...); err != nil {
+			return removed, err
+		}
+		removed = append(removed, o.RegKey)
+	}
+	return removed, nil
+}
@@ -0,0 +1,123 @@
+package bigiq
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPruneRegKeyOfferingsSkipsUsedKeys(t *testing.T) {
+	var deleted []string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		path := r.URL.Path
+		switch {
+		case r.Method == http.MethodDelete:
+			deleted = append(deleted, path[strings.LastIndex(path, "/")+1:])
+			w.Write([]byte(`{}`))
+		case strings.HasSuffix(path, "/regkey/licenses"):
+			w.Write([]byte(`{"items":[{"id":"pool-1","name":"pool"}]}`))
+		case strings.HasSuffix(path, "/offerings"):
+			w.Write([]byte(`{"items":[
+				{"regKey":"USED","status":"READY","licenseState":{"licenseEndDateTime":"2030-01-01T00:00:00Z"}},
+				{"regKey":"IDLE","status":"READY"},
+				{"regKey":"BUSY","status":"LICENSING_ACTIVATION_IN_PROGRESS"}]}`))
+		case strings.HasSuffix(path, "/USED/members"):
+			w.Write([]byte(`{"items":[{"id":"m1"}]}`))
+		default:
+			w.Write([]byte(`{"items":[]}`))
+		}
+	}))
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+
+	offerings, err := b.RegKeyOfferings("pool")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, offerings[0].Members)
+	expires, ok := offerings[0].Expires()
+	assert.True(t, ok)
+	assert.Equal(t, 2030, expires.Year())
+
+	removed, err := b.PruneRegKeyOfferings("pool")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"IDLE"}, removed)
+	assert.Equal(t, []string{"IDLE"}, deleted)
+}
+
+func TestPruneRegKeyOfferingsKeepsKeysMidActivation(t *testing.T) {
+	statuses := []ActivationStatus{
+		ActivationAutomatic, ActivationManual, ActivationInProgress, ActivationNeedEULA,
+		ActivationAutomaticNeedEULA, ActivationEULAAccepted, ActivationNeedLicenseText,
+		ActivationLicenseTextEntered, OfferingReady, OfferingActivationFailed,
+	}
+	var deleted []string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		path := r.URL.Path
+		switch {
+		case r.Method == http.MethodDelete:
+			deleted = append(deleted, path[strings.LastIndex(path, "/")+1:])
+			w.Write([]byte(`{}`))
+		case strings.HasSuffix(path, "/regkey/licenses"):
+			w.Write([]byte(`{"items":[{"id":"pool-1","name":"pool"}]}`))
+		case strings.HasSuffix(path, "/offerings"):
+			var items []string
+			for _, s := range statuses {
+				items = append(items, `{"regKey":"`+string(s)+`","status":"`+string(s)+`"}`)
+			}
+			w.Write([]byte(`{"items":[` + strings.Join(items, ",") + `]}`))
+		default:
+			w.Write([]byte(`{"items":[]}`))
+		}
+	}))
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+
+	removed, err := b.PruneRegKeyOfferings("pool")
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{string(OfferingReady), string(OfferingActivationFailed)}, removed)
+	assert.Equal(t, removed, deleted)
+}
+
+func TestActivateRegKeyOfferingFinishesWhenReady(t *testing.T) {
+	// The offering fails once, is retried and becomes READY.
+	states := []ActivationStatus{ActivationInProgress, OfferingActivationFailed, ActivationInProgress, OfferingReady}
+	var patches []ActivationStatus
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/regkey/licenses"):
+			w.Write([]byte(`{"items":[{"id":"pool-1","name":"pool"}]}`))
+			return
+		case r.Method == http.MethodPatch:
+			var body regKeyOfferingRequest
+			json.NewDecoder(r.Body).Decode(&body)
+			patches = append(patches, body.Status)
+		}
+		json.NewEncoder(w).Encode(Activation{RegKey: "AAAAA-BBBBB", Status: states[0]})
+		if r.Method == http.MethodGet && len(states) > 1 {
+			states = states[1:]
+		}
+	}))
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	activation, err := b.ActivateRegKeyOffering(ctx, "pool", ActivationOptions{
+		RegKey:       "AAAAA-BBBBB",
+		PollInterval: time.Millisecond,
+		MaxRetries:   1,
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, OfferingReady, activation.Status)
+	assert.Equal(t, []ActivationStatus{ActivationAutomatic}, patches)
+}
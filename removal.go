@@ -0,0 +1,198 @@
+package bigiq
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	uriRemoveMgmtAuthority = "device-remove-mgmt-authority"
+	uriRemoveTrust         = "device-remove-trust"
+)
+
+var allDeviceModules = []DeviceModule{ModuleLTM, ModuleASM, ModuleAFM, ModuleDNS, ModuleAPM}
+
+// RemoveDeviceOptions controls RemoveManagedDevice.
+type RemoveDeviceOptions struct {
+	// Modules lists the services to remove. Defaults to LTM, ASM, AFM, DNS
+	// and APM.
+	Modules []DeviceModule
+	// RevokeLicense revokes the license of the device, from whichever pool
+	// it comes, before BIG-IQ stops managing it.
+	RevokeLicense bool
+	// LicenseCredentials are needed to revoke the license of a device that
+	// BIG-IQ licensed as unmanaged.
+	LicenseCredentials *UnmanagedDevice
+	DeviceTaskOptions
+}
+
+// RemoveDeviceResult holds what RemoveManagedDevice did. Leftovers lists
+// what BIG-IQ still knows about the device afterwards; it is empty when the
+// device was removed cleanly.
+type RemoveDeviceResult struct {
+	MachineID      string
+	Address        string
+	RevokedLicense *LicenseAssignment
+	// LicenseNotFound is set when RevokeLicense was requested but no pool
+	// licenses the device.
+	LicenseNotFound bool
+	ServiceRemoval  *DeviceTask
+	TrustRemoval    *DeviceTask
+	Leftovers       []string
+}
+
+type removeServicesRequest struct {
+	DeviceReference DeviceRef   `json:"deviceReference"`
+	ModuleList      []moduleRef `json:"moduleList"`
+}
+
+type removeTrustRequest struct {
+	DeviceReference DeviceRef `json:"deviceReference"`
+	DeviceIP        string    `json:"deviceIp"`
+}
+
+// findManagedDevice looks device up by address, hostname, UUID or machine ID
+// without going through the response cache.
+func (b *BigIQ) findManagedDevice(device string) (*deviceInfo, error) {
+	devices, err := b.GetManagedDevices()
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range devices.DevicesInfo {
+		if device == d.Address || device == d.Hostname || device == d.UUID || device == d.MachineID {
+			return &d, nil
+		}
+	}
+	return nil, nil
+}
+
+// deviceAssignment returns the license assignment of d, matched on its
+// address, management address, machine ID or UUID, or nil if it is not
+// licensed.
+func (b *BigIQ) deviceAssignment(d *deviceInfo) (*LicenseAssignment, error) {
+	assignments, err := b.LicenseAssignments()
+	if err != nil {
+		return nil, err
+	}
+	for i := range assignments {
+		if assignments[i].matches(d.Address, "", d.MachineID) || assignments[i].matches(d.ManagementAddress, "", d.UUID) {
+			return &assignments[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// RemoveManagedDevice takes the BIG-IP with the given address, hostname,
+// UUID or machine ID out of BIG-IQ management: it optionally revokes its
+// license, removes its services, removes the trust and waits for each task.
+// It then checks what BIG-IQ still holds for the device and reports it in
+// Leftovers.
+func (b *BigIQ) RemoveManagedDevice(ctx context.Context, device string, opts RemoveDeviceOptions) (*RemoveDeviceResult, error) {
+	d, err := b.findManagedDevice(device)
+	if err != nil {
+		return nil, err
+	}
+	if d == nil {
+		return nil, fmt.Errorf("device %s is not managed by BIG-IQ", device)
+	}
+	result := &RemoveDeviceResult{MachineID: d.MachineID, Address: d.Address}
+	if result.MachineID == "" {
+		result.MachineID = d.UUID
+	}
+	defer b.invalidateManagedDevices()
+
+	if opts.RevokeLicense {
+		assignment, err := b.deviceAssignment(d)
+		if err != nil {
+			return result, err
+		}
+		if assignment == nil {
+			log.Printf("[WARN] no license of device %s found to revoke", d.Address)
+			result.LicenseNotFound = true
+		} else {
+			start := time.Now()
+			err := b.revokeAssignment(ctx, assignment, opts.LicenseCredentials)
+			b.recordTeem(TeemLicenseRevoke, start, err)
+			if err != nil {
+				return result, fmt.Errorf("revoking license of %s: %v", d.Address, err)
+			}
+			result.RevokedLicense = assignment
+		}
+	}
+
+	modules := opts.Modules
+	if len(modules) == 0 {
+		modules = allDeviceModules
+	}
+	services := removeServicesRequest{DeviceReference: machineLink(result.MachineID)}
+	for _, m := range withSharedModules(modules) {
+		services.ModuleList = append(services.ModuleList, moduleRef{Module: m})
+	}
+	task, err := b.startDeviceTask("service removal", services, uriMgmt, uriCm, uriGlobal, uriTasks, uriRemoveMgmtAuthority)
+	if err != nil {
+		return result, err
+	}
+	result.ServiceRemoval, err = b.WaitForDeviceTask(ctx, task, opts.DeviceTaskOptions)
+	if err != nil {
+		return result, err
+	}
+
+	trust := removeTrustRequest{DeviceReference: machineLink(result.MachineID), DeviceIP: d.Address}
+	task, err = b.startDeviceTask("trust removal", trust, uriMgmt, uriCm, uriGlobal, uriTasks, uriRemoveTrust)
+	if err != nil {
+		return result, err
+	}
+	result.TrustRemoval, err = b.WaitForDeviceTask(ctx, task, opts.DeviceTaskOptions)
+	if err != nil {
+		return result, err
+	}
+
+	result.Leftovers, err = b.deviceLeftovers(d, result.MachineID, opts.RevokeLicense)
+	for _, leftover := range result.Leftovers {
+		log.Printf("[WARN] device %s removed with leftover: %s", d.Address, leftover)
+	}
+	return result, err
+}
+
+// deviceLeftovers lists the entries BIG-IQ still has for a removed device.
+func (b *BigIQ) deviceLeftovers(removed *deviceInfo, machineID string, license bool) ([]string, error) {
+	var leftovers []string
+	d, err := b.findManagedDevice(machineID)
+	if err == nil && d == nil {
+		d, err = b.findManagedDevice(removed.Address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if d != nil {
+		leftovers = append(leftovers, fmt.Sprintf("still listed in %s as %s", uriCmBigIQ, d.SelfLink))
+	}
+	var resolved DeviceTask
+	err, ok := b.getForEntity(&resolved, uriMgmt, uriCm, uriSystem, uriMachineResolver, machineID)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		leftovers = append(leftovers, fmt.Sprintf("machine ID %s still known to %s", machineID, uriMachineResolver))
+	}
+	if license {
+		assignment, err := b.deviceAssignment(removed)
+		if err != nil {
+			return nil, err
+		}
+		if assignment != nil {
+			leftovers = append(leftovers, fmt.Sprintf("still licensed from %s pool %s", assignment.PoolType, assignment.PoolName))
+		}
+	}
+	return leftovers, nil
+}
+
+// invalidateManagedDevices drops cached device lookups, so GetDeviceId stops
+// returning a removed device.
+func (b *BigIQ) invalidateManagedDevices() {
+	if b.cache != nil {
+		b.cache.invalidate(managedDevicesPath)
+	}
+}
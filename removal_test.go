@@ -0,0 +1,112 @@
+package bigiq
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemoveManagedDevice(t *testing.T) {
+	removed := false
+	var modules []moduleRef
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		path := r.URL.Path
+		switch {
+		case strings.HasSuffix(path, "/cm-bigip-allBigIpDevices/devices"):
+			if removed {
+				w.Write([]byte(`{"items":[]}`))
+				return
+			}
+			w.Write([]byte(`{"items":[{"address":"10.0.0.5","hostname":"bigip1","machineId":"m-1","uuid":"m-1","selfLink":"https://localhost/devices/m-1"}]}`))
+		case r.Method == http.MethodPost && strings.HasSuffix(path, "/device-remove-mgmt-authority"):
+			var body removeServicesRequest
+			json.NewDecoder(r.Body).Decode(&body)
+			modules = body.ModuleList
+			w.Write([]byte(`{"id":"rma-1","status":"STARTED"}`))
+		case r.Method == http.MethodPost && strings.HasSuffix(path, "/device-remove-trust"):
+			removed = true
+			w.Write([]byte(`{"id":"rt-1","status":"STARTED"}`))
+		case strings.HasSuffix(path, "/machineid-resolver/m-1"):
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"code":404,"message":"Object not found"}`))
+		default:
+			w.Write([]byte(`{"id":"x","status":"FINISHED"}`))
+		}
+	}))
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", &ConfigOptions{APICallTimeout: 5 * time.Second, CacheTTL: time.Minute})
+
+	link, err := b.GetDeviceId("bigip1")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://localhost/devices/m-1", link)
+
+	result, err := b.RemoveManagedDevice(context.Background(), "bigip1", RemoveDeviceOptions{
+		Modules:           []DeviceModule{ModuleLTM, ModuleAFM},
+		DeviceTaskOptions: DeviceTaskOptions{PollInterval: time.Millisecond},
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "m-1", result.MachineID)
+	assert.Empty(t, result.Leftovers)
+	assert.Equal(t, []moduleRef{{ModuleLTM}, {ModuleSecurityShared}, {ModuleAFM}}, modules)
+	link, err = b.GetDeviceId("bigip1")
+	assert.Nil(t, err)
+	assert.Equal(t, "", link)
+}
+
+func TestRemoveManagedDeviceRevokesByMachineID(t *testing.T) {
+	for _, licensed := range []bool{true, false} {
+		var deleted []string
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			path := r.URL.Path
+			switch {
+			case r.Method == http.MethodDelete:
+				deleted = append(deleted, path)
+				w.Write([]byte(`{}`))
+			case strings.HasSuffix(path, "/cm-bigip-allBigIpDevices/devices"):
+				w.Write([]byte(`{"items":[{"address":"10.0.0.5","hostname":"bigip1","machineId":"m-1","uuid":"m-1"}]}`))
+			case strings.HasSuffix(path, "/purchased-pool/licenses"):
+				w.Write([]byte(`{"items":[{"uuid":"pp-1","name":"pp"}]}`))
+			case strings.HasSuffix(path, "/pp-1/members") && licensed:
+				// The member still carries the address the device had when it
+				// was licensed.
+				w.Write([]byte(`{"items":[{"id":"mem-1","deviceAddress":"10.9.9.9","deviceMachineId":"m-1"}]}`))
+			case strings.HasSuffix(path, "/pp-1/members/mem-1") || strings.HasSuffix(path, "/machineid-resolver/m-1"):
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"code":404,"message":"Object not found"}`))
+			case r.Method == http.MethodPost:
+				w.Write([]byte(`{"id":"task-1","status":"STARTED"}`))
+			case strings.HasSuffix(path, "/task-1"):
+				w.Write([]byte(`{"id":"task-1","status":"FINISHED"}`))
+			default:
+				w.Write([]byte(`{"items":[]}`))
+			}
+		}))
+		b := NewSession(server.URL, "", "", "", &ConfigOptions{APICallTimeout: 5 * time.Second, LicensePollInterval: time.Millisecond})
+
+		result, err := b.RemoveManagedDevice(context.Background(), "10.0.0.5", RemoveDeviceOptions{
+			RevokeLicense:     true,
+			DeviceTaskOptions: DeviceTaskOptions{PollInterval: time.Millisecond},
+		})
+		server.Close()
+
+		assert.Nil(t, err)
+		if licensed {
+			assert.Equal(t, "mem-1", result.RevokedLicense.MemberID)
+			assert.False(t, result.LicenseNotFound)
+			assert.Equal(t, []string{"/mgmt/cm/device/licensing/pool/purchased-pool/licenses/pp-1/members/mem-1"}, deleted)
+		} else {
+			assert.Nil(t, result.RevokedLicense)
+			assert.True(t, result.LicenseNotFound)
+			assert.Empty(t, deleted)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package bigiq
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// SelectionStrategy decides which of the eligible pools SelectPool picks.
+type SelectionStrategy string
+
+const (
+	// StrategyFirstFit picks the first eligible pool in pool type
+	// preference order, then inventory order.
+	StrategyFirstFit SelectionStrategy = "first-fit"
+	// StrategyMostFree picks the eligible pool with the most free slots.
+	// Utility offerings are metered and count as unlimited; pools whose
+	// capacity BIG-IQ does not report come last.
+	StrategyMostFree SelectionStrategy = "most-free"
+	// StrategyCheapestUnit picks the eligible pool with the lowest cost in
+	// PoolRequirements.UnitCosts. Pools without a cost come last.
+	StrategyCheapestUnit SelectionStrategy = "cheapest-unit"
+)
+
+// PoolRequirements describes the license a device needs. Product, Throughput
+// and Modules are case-insensitive keywords matched against the SKU, offering
+// and name of each pool, e.g. Product "BIG-IP", Throughput "10G", Modules
+// ["BT"]. They match whole words, where words are separated by anything but
+// letters and digits: "10G" matches F5-BIG-MSP-BT-10G but not 100G, and
+// "prod" does not match nonprod-pool.
+type PoolRequirements struct {
+	Product    string
+	Throughput string
+	Modules    []string
+	// PoolTypes lists the acceptable pool types (PoolTypeRegKey,
+	// PoolTypePurchased, PoolTypeUtility) in order of preference. Empty
+	// accepts all, purchased first, then regkey, then utility.
+	PoolTypes []string
+	// Tenant and UnitOfMeasure are passed on to the license task. Utility
+	// offerings require UnitOfMeasure.
+	Tenant        string
+	UnitOfMeasure string
+	// UnitCosts maps a SKU or pool name to its cost per license, for
+	// StrategyCheapestUnit.
+	UnitCosts map[string]float64
+}
+
+// PoolCandidate is one pool or offering considered by SelectPool. Rejected
+// explains why it is not eligible and is empty for eligible candidates.
+type PoolCandidate struct {
+	Entry    InventoryEntry
+	Rejected string
+}
+
+// PoolSelection is the outcome of SelectPool.
+type PoolSelection struct {
+	Selected   *InventoryEntry
+	Strategy   SelectionStrategy
+	Candidates []PoolCandidate
+}
+
+var defaultPoolTypes = []string{PoolTypePurchased, PoolTypeRegKey, PoolTypeUtility}
+
+// SelectPool picks the best pool or offering with free capacity for req
+// across the regkey, purchased and utility pools. The selection lists every
+// candidate with the reason it was rejected, also when nothing fits.
+func (b *BigIQ) SelectPool(req PoolRequirements, strategy SelectionStrategy) (*PoolSelection, error) {
+	inventory, err := b.LicenseInventory()
+	if err != nil {
+		return nil, err
+	}
+	return SelectPoolFrom(inventory, req, strategy)
+}
+
+// SelectPoolFrom is SelectPool over an inventory that was already fetched.
+func SelectPoolFrom(inventory *Inventory, req PoolRequirements, strategy SelectionStrategy) (*PoolSelection, error) {
+	switch strategy {
+	case "":
+		strategy = StrategyFirstFit
+	case StrategyFirstFit, StrategyMostFree, StrategyCheapestUnit:
+	default:
+		return nil, fmt.Errorf("unknown selection strategy %q", strategy)
+	}
+	poolTypes := req.PoolTypes
+	if len(poolTypes) == 0 {
+		poolTypes = defaultPoolTypes
+	}
+	preference := make(map[string]int)
+	for i, t := range poolTypes {
+		preference[t] = i
+	}
+
+	selection := &PoolSelection{Strategy: strategy}
+	var eligible []InventoryEntry
+	for _, e := range inventory.Entries {
+		reason := req.rejects(e, preference)
+		selection.Candidates = append(selection.Candidates, PoolCandidate{Entry: e, Rejected: reason})
+		if reason == "" {
+			eligible = append(eligible, e)
+		}
+	}
+	if len(eligible) == 0 {
+		return selection, fmt.Errorf("no license pool satisfies the requirements (%d candidates rejected)", len(selection.Candidates))
+	}
+
+	sort.SliceStable(eligible, func(i, j int) bool {
+		a, c := eligible[i], eligible[j]
+		switch strategy {
+		case StrategyMostFree:
+			if fa, fc := freeSlots(a), freeSlots(c); fa != fc {
+				return fa > fc
+			}
+		case StrategyCheapestUnit:
+			if ca, cc := req.unitCost(a), req.unitCost(c); ca != cc {
+				return ca < cc
+			}
+		}
+		return preference[a.PoolType] < preference[c.PoolType]
+	})
+	selection.Selected = &eligible[0]
+	return selection, nil
+}
+
+// rejects returns why e cannot satisfy req, or "" if it can.
+func (req PoolRequirements) rejects(e InventoryEntry, preference map[string]int) string {
+	if _, ok := preference[e.PoolType]; !ok {
+		return fmt.Sprintf("pool type %s not requested", e.PoolType)
+	}
+	label := keywordTokens(e.SKU + " " + e.Offering + " " + e.Pool)
+	for _, kw := range []struct{ what, value string }{{"product", req.Product}, {"throughput", req.Throughput}} {
+		if kw.value != "" && !hasKeyword(label, kw.value) {
+			return fmt.Sprintf("%s %s does not match %s", kw.what, kw.value, strings.TrimSpace(e.SKU+" "+e.Offering))
+		}
+	}
+	for _, module := range req.Modules {
+		if !hasKeyword(label, module) {
+			return fmt.Sprintf("module %s not included in %s", module, strings.TrimSpace(e.SKU+" "+e.Offering))
+		}
+	}
+	switch e.PoolType {
+	case PoolTypeRegKey:
+		if ActivationStatus(e.Status) != OfferingReady {
+			return fmt.Sprintf("registration key is %s", e.Status)
+		}
+	case PoolTypeUtility:
+		if !validUnitOfMeasure(req.UnitOfMeasure) {
+			return "utility offering requires a unit of measure"
+		}
+		return ""
+	}
+	if e.Total > 0 && e.Free == 0 {
+		return fmt.Sprintf("no free capacity (%d of %d used)", e.Used, e.Total)
+	}
+	return ""
+}
+
+// keywordTokens splits s into upper-case words of letters and digits.
+func keywordTokens(s string) []string {
+	return strings.FieldsFunc(strings.ToUpper(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// hasKeyword reports whether the words of keyword appear consecutively in
+// tokens.
+func hasKeyword(tokens []string, keyword string) bool {
+	words := keywordTokens(keyword)
+	for i := 0; i+len(words) <= len(tokens); i++ {
+		match := true
+		for j, w := range words {
+			if tokens[i+j] != w {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// freeSlots ranks capacity for StrategyMostFree: metered utility offerings
+// are unlimited and unknown capacity ranks below any known free slot.
+func freeSlots(e InventoryEntry) int {
+	switch {
+	case e.PoolType == PoolTypeUtility:
+		return math.MaxInt32
+	case e.Total == 0:
+		return -1
+	}
+	return e.Free
+}
+
+func (req PoolRequirements) unitCost(e InventoryEntry) float64 {
+	for _, key := range []string{e.SKU, e.Pool} {
+		if cost, ok := req.UnitCosts[key]; ok && key != "" {
+			return cost
+		}
+	}
+	return math.Inf(1)
+}
+
+// LicenseParam returns the assign task that licenses the device at address
+// from the selected pool. Set the credentials and assignment type for
+// unmanaged devices before posting it.
+func (s *PoolSelection) LicenseParam(address string, req PoolRequirements) *LicenseParam {
+	config := &LicenseParam{
+		Command:         LicenseAssign,
+		Address:         address,
+		LicensePoolName: s.Selected.Pool,
+		Tenant:          req.Tenant,
+	}
+	if s.Selected.PoolType == PoolTypeUtility {
+		config.SkuKeyword1 = s.Selected.SKU
+		config.UnitOfMeasure = req.UnitOfMeasure
+	}
+	return config
+}
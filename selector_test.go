@@ -0,0 +1,78 @@
+package bigiq
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectPoolFromStrategies(t *testing.T) {
+	inventory := &Inventory{Entries: []InventoryEntry{
+		newInventoryEntry(PoolTypePurchased, "small", "KEY-A", "F5-BIG-LTM-10G", "LICENSED", 2, "", []string{"a", "b"}),
+		newInventoryEntry(PoolTypePurchased, "large", "KEY-B", "F5-BIG-LTM-10G", "LICENSED", 10, "", []string{"c"}),
+		newInventoryEntry(PoolTypePurchased, "medium", "KEY-C", "F5-BIG-LTM-10G", "LICENSED", 5, "", nil),
+		newInventoryEntry(PoolTypePurchased, "slow", "KEY-D", "F5-BIG-LTM-1G", "LICENSED", 5, "", nil),
+		newInventoryEntry(PoolTypeUtility, "utility", "BIG-IP Better 10G", "F5-BIG-MSP-BT-10G", "", 0, "", nil),
+	}}
+	req := PoolRequirements{
+		Throughput: "10G",
+		PoolTypes:  []string{PoolTypePurchased},
+		UnitCosts:  map[string]float64{"medium": 1, "large": 2},
+	}
+
+	selection, err := SelectPoolFrom(inventory, req, StrategyFirstFit)
+	assert.Nil(t, err)
+	assert.Equal(t, "large", selection.Selected.Pool)
+	assert.Equal(t, "no free capacity (2 of 2 used)", selection.Candidates[0].Rejected)
+	assert.Contains(t, selection.Candidates[3].Rejected, "throughput 10G does not match")
+	assert.Equal(t, "pool type utility not requested", selection.Candidates[4].Rejected)
+
+	selection, _ = SelectPoolFrom(inventory, req, StrategyMostFree)
+	assert.Equal(t, "large", selection.Selected.Pool)
+
+	selection, _ = SelectPoolFrom(inventory, req, StrategyCheapestUnit)
+	assert.Equal(t, "medium", selection.Selected.Pool)
+
+	req.PoolTypes = []string{PoolTypeUtility}
+	req.UnitOfMeasure = UnitHourly
+	selection, err = SelectPoolFrom(inventory, req, StrategyFirstFit)
+	assert.Nil(t, err)
+	config := selection.LicenseParam("10.0.0.1", req)
+	assert.Equal(t, "utility", config.LicensePoolName)
+	assert.Equal(t, "F5-BIG-MSP-BT-10G", config.SkuKeyword1)
+	assert.Equal(t, UnitHourly, config.UnitOfMeasure)
+}
+
+func TestSelectPoolFromMatchesWholeKeywords(t *testing.T) {
+	inventory := &Inventory{Entries: []InventoryEntry{
+		newInventoryEntry(PoolTypePurchased, "nonprod-pool", "KEY-A", "F5-BIG-LTM-100G", "LICENSED", 5, "", nil),
+		newInventoryEntry(PoolTypePurchased, "prod-pool", "KEY-B", "F5-BIG-LTM-10G", "LICENSED", 5, "", nil),
+	}}
+
+	selection, err := SelectPoolFrom(inventory, PoolRequirements{Product: "prod"}, StrategyFirstFit)
+	assert.Nil(t, err)
+	assert.Equal(t, "prod-pool", selection.Selected.Pool)
+	assert.Contains(t, selection.Candidates[0].Rejected, "product prod does not match")
+
+	selection, err = SelectPoolFrom(inventory, PoolRequirements{Product: "big-ltm", Throughput: "10g"}, StrategyFirstFit)
+	assert.Nil(t, err)
+	assert.Equal(t, "prod-pool", selection.Selected.Pool)
+
+	_, err = SelectPoolFrom(inventory, PoolRequirements{Modules: []string{"LT"}}, StrategyFirstFit)
+	assert.NotNil(t, err)
+}
+
+func TestSelectPoolFromRequiresReadyRegKeys(t *testing.T) {
+	inventory := &Inventory{Entries: []InventoryEntry{
+		newInventoryEntry(PoolTypeRegKey, "keys", "AAAAA-BBBBB", "", string(ActivationInProgress), 1, "", nil),
+		newInventoryEntry(PoolTypeRegKey, "keys", "CCCCC-DDDDD", "", string(OfferingReady), 1, "", []string{"a"}),
+		newInventoryEntry(PoolTypeRegKey, "keys", "EEEEE-FFFFF", "", string(OfferingReady), 1, "", nil),
+	}}
+
+	selection, err := SelectPoolFrom(inventory, PoolRequirements{}, StrategyFirstFit)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "EEEEE-FFFFF", selection.Selected.Offering)
+	assert.Equal(t, "registration key is LICENSING_ACTIVATION_IN_PROGRESS", selection.Candidates[0].Rejected)
+	assert.Equal(t, "no free capacity (1 of 1 used)", selection.Candidates[1].Rejected)
+}
@@ -0,0 +1,251 @@
+package bigiq
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	restjavadMinBackoff     = time.Second
+	restjavadMaxBackoff     = 30 * time.Second
+	defaultRestjavadTimeout = 5 * time.Minute
+)
+
+// BigIQLicenseSummary is the BIG-IQ's own license registration.
+type BigIQLicenseSummary struct {
+	RegistrationKey      string   `json:"registrationKey"`
+	AddOnKeys            []string `json:"addOnKeys,omitempty"`
+	ActiveModules        []string `json:"activeModules,omitempty"`
+	PlatformID           string   `json:"platformId,omitempty"`
+	LicensedDateTime     string   `json:"licensedDateTime,omitempty"`
+	ServiceCheckDateTime string   `json:"serviceCheckDateTime,omitempty"`
+	LicenseEndDateTime   string   `json:"licenseEndDateTime,omitempty"`
+	Generation           int64    `json:"generation,omitempty"`
+	LastUpdateMicros     int64    `json:"lastUpdateMicros,omitempty"`
+}
+
+// changedSince reports whether the registration was rewritten after before,
+// as it is when a license is installed.
+func (s *BigIQLicenseSummary) changedSince(before *BigIQLicenseSummary) bool {
+	return s.Generation != before.Generation || s.LastUpdateMicros != before.LastUpdateMicros
+}
+
+// Expires returns the end of the license term, if the license has one.
+func (s *BigIQLicenseSummary) Expires() (time.Time, bool) {
+	return parseLicenseDate(s.LicenseEndDateTime)
+}
+
+// ServiceCheck returns the service check date, which must be later than the
+// build date of any software installed on the BIG-IQ.
+func (s *BigIQLicenseSummary) ServiceCheck() (time.Time, bool) {
+	return parseLicenseDate(s.ServiceCheckDateTime)
+}
+
+// selfActivation is the BIG-IQ's own license activation.
+type selfActivation struct {
+	BaseRegKey            string           `json:"baseRegKey"`
+	AddOnKeys             []string         `json:"addOnKeys,omitempty"`
+	IsAutomaticActivation bool             `json:"isAutomaticActivation"`
+	Status                ActivationStatus `json:"status,omitempty"`
+	EulaText              string           `json:"eulaText,omitempty"`
+	Dossier               string           `json:"dossier,omitempty"`
+	LicenseText           string           `json:"licenseText,omitempty"`
+	ErrorText             string           `json:"errorText,omitempty"`
+}
+
+// BigIQLicenseOptions selects the keys of a BIG-IQ self-license activation.
+type BigIQLicenseOptions struct {
+	BaseRegKey string
+	AddOnKeys  []string
+	// PollInterval is the delay between activation status polls. Defaults
+	// to 5 seconds.
+	PollInterval time.Duration
+}
+
+// BigIQLicense returns the BIG-IQ's own license registration.
+func (b *BigIQ) BigIQLicense() (*BigIQLicenseSummary, error) {
+	var summary BigIQLicenseSummary
+	err, ok := b.getForEntity(&summary, uriShared, uriLicensing, uriRegistration)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("BIG-IQ is not licensed")
+	}
+	return &summary, nil
+}
+
+// WaitForRestjavad waits, with exponential backoff, for the BIG-IQ REST
+// service to restart after a license is installed: it returns once the
+// service answers again after having been down, or once the license
+// registration differs from the one the service first answered with.
+// Without a deadline on ctx it gives up after five minutes.
+func (b *BigIQ) WaitForRestjavad(ctx context.Context) error {
+	return b.waitForRestjavad(ctx, nil)
+}
+
+// waitForRestjavad is WaitForRestjavad comparing against the registration
+// before, which is taken from the first answer when nil.
+func (b *BigIQ) waitForRestjavad(ctx context.Context, before *BigIQLicenseSummary) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultRestjavadTimeout)
+		defer cancel()
+	}
+	start := time.Now()
+	attempts := 0
+	defer func() {
+		b.metrics().ObserveTaskPoll(TaskBigIQLicense, attempts, time.Since(start))
+	}()
+	backoff := restjavadMinBackoff
+	down := false
+	for {
+		attempts++
+		var summary BigIQLicenseSummary
+		err, _ := b.getForEntity(&summary, uriShared, uriLicensing, uriRegistration)
+		switch {
+		case err != nil:
+			down = true
+			log.Printf("[DEBUG] waiting %v for BIG-IQ REST service: %v", backoff, err)
+		case down || (before != nil && summary.changedSince(before)):
+			return nil
+		case before == nil:
+			before = &summary
+			fallthrough
+		default:
+			err = fmt.Errorf("BIG-IQ REST service has not restarted")
+			log.Printf("[DEBUG] waiting %v for BIG-IQ REST service to restart", backoff)
+		}
+		b.metrics().IncRetry(TaskBigIQLicense)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("BIG-IQ REST service did not come back: %v", err)
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > restjavadMaxBackoff {
+			backoff = restjavadMaxBackoff
+		}
+	}
+}
+
+// ActivateBigIQLicense activates the BIG-IQ's own license automatically with
+// the F5 license server, accepting the EULA, installs the license and waits
+// for the REST service to restart. It returns the new registration.
+func (b *BigIQ) ActivateBigIQLicense(ctx context.Context, opts BigIQLicenseOptions) (*BigIQLicenseSummary, error) {
+	activation, err := b.runSelfActivation(ctx, opts, true)
+	if err != nil {
+		return nil, err
+	}
+	if activation.Status != ActivationComplete {
+		return nil, &ActivationError{RegKey: opts.BaseRegKey, Status: activation.Status, Message: activation.ErrorText}
+	}
+	return b.installBigIQLicense(ctx, activation.LicenseText)
+}
+
+// StartBigIQManualActivation starts an offline activation of the BIG-IQ's
+// own license and returns the dossier to submit at the F5 activation portal.
+// Finish with CompleteBigIQManualActivation.
+func (b *BigIQ) StartBigIQManualActivation(ctx context.Context, opts BigIQLicenseOptions) (string, error) {
+	activation, err := b.runSelfActivation(ctx, opts, false)
+	if err != nil {
+		return "", err
+	}
+	if activation.Dossier == "" {
+		return "", &ActivationError{RegKey: opts.BaseRegKey, Status: activation.Status, Message: activation.ErrorText}
+	}
+	return activation.Dossier, nil
+}
+
+// CompleteBigIQManualActivation installs the license text obtained from the
+// F5 activation portal and waits for the REST service to restart.
+func (b *BigIQ) CompleteBigIQManualActivation(ctx context.Context, licenseText string) (*BigIQLicenseSummary, error) {
+	return b.installBigIQLicense(ctx, licenseText)
+}
+
+// AddBigIQAddOnKeys reactivates the current base registration key together
+// with its existing and the given add-on keys.
+func (b *BigIQ) AddBigIQAddOnKeys(ctx context.Context, keys ...string) (*BigIQLicenseSummary, error) {
+	current, err := b.BigIQLicense()
+	if err != nil {
+		return nil, err
+	}
+	addOns := append([]string{}, current.AddOnKeys...)
+	for _, key := range keys {
+		if !contains(addOns, key) {
+			addOns = append(addOns, key)
+		}
+	}
+	return b.ActivateBigIQLicense(ctx, BigIQLicenseOptions{BaseRegKey: current.RegistrationKey, AddOnKeys: addOns})
+}
+
+// ReactivateBigIQLicense reactivates the current base registration key and
+// add-on keys, e.g. to pick up a renewed service check date.
+func (b *BigIQ) ReactivateBigIQLicense(ctx context.Context) (*BigIQLicenseSummary, error) {
+	return b.AddBigIQAddOnKeys(ctx)
+}
+
+// runSelfActivation posts the activation and polls it until it is complete,
+// failed or, for manual activations, has produced the dossier.
+func (b *BigIQ) runSelfActivation(ctx context.Context, opts BigIQLicenseOptions, automatic bool) (*selfActivation, error) {
+	request := selfActivation{
+		BaseRegKey:            opts.BaseRegKey,
+		AddOnKeys:             opts.AddOnKeys,
+		IsAutomaticActivation: automatic,
+	}
+	if err := b.post(request, uriShared, uriLicensing, uriActivation); err != nil {
+		return nil, err
+	}
+	interval := opts.PollInterval
+	if interval <= 0 {
+		interval = activationPollInterval
+	}
+	var activation selfActivation
+	eulaAccepted := false
+	err := b.pollTask(ctx, TaskBigIQLicense, interval, func() (bool, error) {
+		activation = selfActivation{}
+		err, _ := b.getForEntity(&activation, uriShared, uriLicensing, uriActivation)
+		if err != nil {
+			return false, err
+		}
+		switch {
+		case activation.Status.NeedsEULA():
+			// The status lags behind the accepted EULA; post it only once.
+			if eulaAccepted {
+				return false, nil
+			}
+			eulaAccepted = true
+			request.EulaText = activation.EulaText
+			return false, b.post(request, uriShared, uriLicensing, uriActivation)
+		case !automatic && activation.Dossier != "":
+			return true, nil
+		}
+		return activation.Status.Done(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &activation, nil
+}
+
+func (b *BigIQ) installBigIQLicense(ctx context.Context, licenseText string) (*BigIQLicenseSummary, error) {
+	if licenseText == "" {
+		return nil, fmt.Errorf("no license text to install")
+	}
+	// An unlicensed BIG-IQ has no registration yet, which any new one differs
+	// from.
+	var before BigIQLicenseSummary
+	err, _ := b.getForEntity(&before, uriShared, uriLicensing, uriRegistration)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.InstallLicense(licenseText); err != nil {
+		return nil, err
+	}
+	if err := b.waitForRestjavad(ctx, &before); err != nil {
+		return nil, err
+	}
+	return b.BigIQLicense()
+}
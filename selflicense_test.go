@@ -0,0 +1,134 @@
+package bigiq
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestActivateBigIQLicense(t *testing.T) {
+	states := []ActivationStatus{ActivationInProgress, ActivationNeedEULA, ActivationComplete}
+	var posted []selfActivation
+	var installed string
+	restarting := true
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/activation") && r.Method == http.MethodPost:
+			var body selfActivation
+			json.NewDecoder(r.Body).Decode(&body)
+			posted = append(posted, body)
+			json.NewEncoder(w).Encode(body)
+		case strings.HasSuffix(r.URL.Path, "/activation"):
+			json.NewEncoder(w).Encode(selfActivation{Status: states[0], EulaText: "eula", LicenseText: "license"})
+			if len(states) > 1 {
+				states = states[1:]
+			}
+		case r.Method == http.MethodPut:
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			installed = body["licenseText"]
+			w.Write([]byte(`{}`))
+		case restarting && installed != "":
+			// restjavad is down once while the license is installed.
+			restarting = false
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"code":503,"message":"restarting"}`))
+		default:
+			json.NewEncoder(w).Encode(BigIQLicenseSummary{
+				RegistrationKey:      "AAAAA-BBBBB",
+				AddOnKeys:            []string{"CCCCC-DDDDD"},
+				ActiveModules:        []string{"BIG-IQ, VE"},
+				ServiceCheckDateTime: "2027-01-01T00:00:00-08:00",
+				LicenseEndDateTime:   "2027-06-01T00:00:00-08:00",
+			})
+		}
+	}))
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+
+	summary, err := b.ActivateBigIQLicense(context.Background(), BigIQLicenseOptions{
+		BaseRegKey:   "AAAAA-BBBBB",
+		AddOnKeys:    []string{"CCCCC-DDDDD"},
+		PollInterval: time.Millisecond,
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(posted))
+	assert.True(t, posted[0].IsAutomaticActivation)
+	assert.Equal(t, "", posted[0].EulaText)
+	assert.Equal(t, "eula", posted[1].EulaText)
+	assert.Equal(t, "license", installed)
+	assert.Equal(t, "AAAAA-BBBBB", summary.RegistrationKey)
+	expires, ok := summary.Expires()
+	assert.True(t, ok)
+	assert.Equal(t, 2027, expires.Year())
+}
+
+func TestSelfActivationPostsEULAOnce(t *testing.T) {
+	states := []ActivationStatus{ActivationNeedEULA, ActivationNeedEULA, ActivationNeedEULA, ActivationComplete}
+	posts := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodPost {
+			posts++
+			w.Write([]byte(`{}`))
+			return
+		}
+		json.NewEncoder(w).Encode(selfActivation{Status: states[0], EulaText: "eula", LicenseText: "license"})
+		if len(states) > 1 {
+			states = states[1:]
+		}
+	}))
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+
+	activation, err := b.runSelfActivation(context.Background(), BigIQLicenseOptions{BaseRegKey: "AAAAA-BBBBB", PollInterval: time.Millisecond}, true)
+
+	assert.Nil(t, err)
+	assert.Equal(t, ActivationComplete, activation.Status)
+	assert.Equal(t, 2, posts)
+}
+
+func TestWaitForRestjavadWaitsForRestart(t *testing.T) {
+	// The service keeps answering with the old registration for a while,
+	// then with the new one without an observed outage.
+	gets := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		gets++
+		generation := int64(1)
+		if gets > 1 {
+			generation = 2
+		}
+		json.NewEncoder(w).Encode(BigIQLicenseSummary{RegistrationKey: "AAAAA-BBBBB", Generation: generation})
+	}))
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+
+	err := b.WaitForRestjavad(context.Background())
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, gets)
+}
+
+func TestWaitForRestjavadNeedsARestart(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(BigIQLicenseSummary{RegistrationKey: "AAAAA-BBBBB", Generation: 1})
+	}))
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := b.WaitForRestjavad(ctx)
+
+	assert.Contains(t, err.Error(), "has not restarted")
+}
@@ -10,6 +10,7 @@ import (
 	"os"
 	"reflect"
 	"strings"
+	"time"
 )
 
 const (
@@ -20,13 +21,6 @@ const (
 	uriRegistration   = "registration"
 	uriFileTransfer   = "file-transfer"
 	uriUploads        = "uploads"
-
-	activationComplete   = "LICENSING_COMPLETE"
-	activationInProgress = "LICENSING_ACTIVATION_IN_PROGRESS"
-	activationFailed     = "LICENSING_FAILED"
-	activationNeedEula   = "NEED_EULA_ACCEPT"
-	activationAutoEULA   = "ACTIVATING_AUTOMATIC_EULA_ACCEPTED"
-	activationManual     = "ACTIVATING_MANUAL_NEED_LICENSE_TEXT"
 )
 
 // Installs the given license.
@@ -109,6 +103,7 @@ func (b *BigIQ) Upload(r io.Reader, size int64, path ...string) (*Upload, error)
 	url := fmt.Sprintf(format, b.Host, options.URL)
 	chunkSize := 512 * 1024
 	var start, end int64
+	uploadStart := time.Now()
 	for {
 		// Read next chunk
 		chunk := make([]byte, chunkSize)
@@ -123,19 +118,23 @@ func (b *BigIQ) Upload(r io.Reader, size int64, path ...string) (*Upload, error)
 		}
 		body := bytes.NewReader(chunk)
 		req, _ := http.NewRequest(strings.ToUpper(options.Method), url, body)
-		if b.Token != "" {
-			req.Header.Set("X-F5-Auth-Token", b.Token)
+		if token := b.currentToken(); token != "" {
+			req.Header.Set("X-F5-Auth-Token", token)
 		} else {
 			req.SetBasicAuth(b.User, b.Password)
 		}
+		b.setClientHeaders(req)
 		req.Header.Add("Content-Type", options.ContentType)
 		req.Header.Add("Content-Range", fmt.Sprintf("%d-%d/%d", start, end-1, size))
 		// Try to upload chunk
+		chunkStart := time.Now()
 		res, err := client.Do(req)
 		if err != nil {
+			b.metrics().ObserveRequest(req.Method, PathTemplate(options.URL), 0, time.Since(chunkStart))
 			return nil, err
 		}
 		data, _ := ioutil.ReadAll(res.Body)
+		b.metrics().ObserveRequest(req.Method, PathTemplate(options.URL), res.StatusCode, time.Since(chunkStart))
 		if res.StatusCode >= 400 {
 			if res.Header.Get("Content-Type") == "application/json" {
 				return nil, b.checkError(data)
@@ -152,6 +151,7 @@ func (b *BigIQ) Upload(r io.Reader, size int64, path ...string) (*Upload, error)
 		start = end
 		if start >= size {
 			// Final chunk was uploaded
+			b.metrics().ObserveUpload(size, time.Since(uploadStart))
 			return &upload, err
 		}
 	}
@@ -819,13 +819,22 @@ func (b *BigIQ) BigIQlicenses() (*BigIQlicense, error) {
 	return &BigIQlicense, nil
 }
 
+// GetBigIQLiceseStatus waits up to 150 seconds for the BIG-IQ license to
+// become readable.
+//
+// Deprecated: use WaitForRestjavad and BigIQLicense.
 func (b *BigIQ) GetBigIQLiceseStatus() (map[string]interface{}, error) {
 	BigIQLicense := make(map[string]interface{})
+	start := time.Now()
 	err, _ := b.getForEntityNew(&BigIQLicense, uriMgmt, uriTm, uriSys, uriLicense)
 	c := 0
+	defer func() {
+		b.metrics().ObserveTaskPoll(TaskBigIQLicense, c+1, time.Since(start))
+	}()
 	for err != nil {
 		time.Sleep(10 * time.Second)
 		c++
+		b.metrics().IncRetry(TaskBigIQLicense)
 		err, _ = b.getForEntityNew(&BigIQLicense, uriMgmt, uriTm, uriSys, uriLicense)
 		if c == 15 {
 			log.Printf("[DEBUG] Device is not up even after waiting for 120 seconds")
@@ -835,6 +844,7 @@ func (b *BigIQ) GetBigIQLiceseStatus() (map[string]interface{}, error) {
 	return BigIQLicense, nil
 }
 
+// Deprecated: use ActivateBigIQLicense.
 func (b *BigIQ) CreateBigIQlicense(command, registration_key string) error {
 	config := &BigIQlicense{
 		Command:          command,
@@ -0,0 +1,190 @@
+package bigiq
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Operations reported to the Teem sink.
+const (
+	TeemLicenseAssign = "license-assign"
+	TeemLicenseRevoke = "license-revoke"
+	TeemAS3Deploy     = "as3-deploy"
+	TeemAS3Delete     = "as3-delete"
+)
+
+// TeemRecord describes one run of a high-level operation. It only carries
+// the operation name, outcome, timing and product versions; declarations,
+// addresses, registration keys and credentials are never included.
+type TeemRecord struct {
+	Operation      string    `json:"operation"`
+	Success        bool      `json:"success"`
+	Count          int64     `json:"count"`
+	DurationMs     int64     `json:"durationMs"`
+	BigIQVersion   string    `json:"bigiqVersion,omitempty"`
+	AS3Version     string    `json:"as3Version,omitempty"`
+	LibraryVersion string    `json:"libraryVersion"`
+	Timestamp      time.Time `json:"timestamp"`
+}
+
+// TeemSink receives usage telemetry when BigIQ.Teem is true. Implementations
+// must be safe for concurrent use.
+type TeemSink interface {
+	Report(record TeemRecord) error
+}
+
+// WriterTeemSink writes each record as a line of JSON to an io.Writer.
+type WriterTeemSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterTeemSink returns a sink that writes JSON lines to w.
+func NewWriterTeemSink(w io.Writer) *WriterTeemSink {
+	return &WriterTeemSink{w: w}
+}
+
+// NewStdoutTeemSink returns a sink that writes JSON lines to standard output.
+func NewStdoutTeemSink() *WriterTeemSink {
+	return NewWriterTeemSink(os.Stdout)
+}
+
+// NewFileTeemSink returns a sink that appends JSON lines to the file at path,
+// creating it if needed. Close the returned file when done.
+func NewFileTeemSink(path string) (*WriterTeemSink, *os.File, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, nil, err
+	}
+	return NewWriterTeemSink(f), f, nil
+}
+
+// Report implements TeemSink.
+func (s *WriterTeemSink) Report(record TeemRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(line, '\n'))
+	return err
+}
+
+// teemVersionRetry is how long a failed product version lookup waits before
+// it is tried again.
+var teemVersionRetry = time.Minute
+
+// teemState holds the per-session operation counts and the product versions.
+type teemState struct {
+	mu     sync.Mutex
+	counts map[string]int64
+	bigiq  versionLookup
+	as3    versionLookup
+	// lookups tracks running version lookups, so tests can wait for them.
+	lookups sync.WaitGroup
+}
+
+// versionLookup is a product version that is fetched in the background the
+// first time it is needed, and fetched again a while after a failure.
+type versionLookup struct {
+	value    string
+	fetching bool
+	retryAt  time.Time
+}
+
+var teemInit sync.Mutex
+
+func (b *BigIQ) teemState() *teemState {
+	teemInit.Lock()
+	defer teemInit.Unlock()
+	if b.teem == nil {
+		b.teem = &teemState{counts: make(map[string]int64)}
+	}
+	return b.teem
+}
+
+// version returns the version held by l, or "" while it is not known yet. An
+// unknown version is looked up in a goroutine, so the lookup never delays
+// the operation being reported.
+func (t *teemState) version(l *versionLookup, fetch func() (string, error)) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if l.value != "" || l.fetching || time.Now().Before(l.retryAt) {
+		return l.value
+	}
+	l.fetching = true
+	t.lookups.Add(1)
+	go func() {
+		defer t.lookups.Done()
+		v, err := fetch()
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		l.fetching = false
+		if err != nil || v == "" {
+			log.Printf("[DEBUG] Teem version lookup failed, retrying in %v: %v", teemVersionRetry, err)
+			l.retryAt = time.Now().Add(teemVersionRetry)
+			return
+		}
+		l.value = v
+	}()
+	return ""
+}
+
+func (b *BigIQ) fetchBigIQVersion() (string, error) {
+	v, err := b.BigIQVersion()
+	if err != nil {
+		return "", err
+	}
+	return v.Entries.HTTPSLocalhostMgmtTmCliVersion0.NestedStats.Entries.Active.Description, nil
+}
+
+func (b *BigIQ) fetchAS3Version() (string, error) {
+	v, err := b.getAs3version()
+	if err != nil {
+		return "", err
+	}
+	return v.Version, nil
+}
+
+// recordTeem reports a finished operation to the Teem sink. It is a no-op
+// unless Teem is enabled and a sink is configured. Product versions are
+// included once they are known.
+func (b *BigIQ) recordTeem(operation string, start time.Time, err error) {
+	if !b.Teem || b.TeemSink == nil {
+		return
+	}
+	t := b.teemState()
+	t.mu.Lock()
+	t.counts[operation]++
+	count := t.counts[operation]
+	t.mu.Unlock()
+
+	record := TeemRecord{
+		Operation:      operation,
+		Success:        err == nil,
+		Count:          count,
+		DurationMs:     time.Since(start).Milliseconds(),
+		BigIQVersion:   t.version(&t.bigiq, b.fetchBigIQVersion),
+		LibraryVersion: LibraryVersion,
+		Timestamp:      time.Now().UTC(),
+	}
+	if operation == TeemAS3Deploy || operation == TeemAS3Delete {
+		record.AS3Version = t.version(&t.as3, b.fetchAS3Version)
+	}
+	if err := b.TeemSink.Report(record); err != nil {
+		log.Printf("[WARN] Teem sink failed for %s: %v", operation, err)
+	}
+}
+
+// teemLicenseOperation maps a license command to its Teem operation.
+func teemLicenseOperation(command LicenseCommand) string {
+	if command == LicenseRevoke {
+		return TeemLicenseRevoke
+	}
+	return TeemLicenseAssign
+}
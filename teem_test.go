@@ -0,0 +1,150 @@
+package bigiq
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const teemDeclaration = `{"class":"AS3","declaration":{"class":"ADC","Secret_Tenant":{"class":"Tenant","app":{"class":"Application","serverAddresses":["10.9.8.7"]}}}}`
+
+// newTeemTestServer answers every call, including the version lookups, with a
+// payload containing values that must never reach a Teem record.
+func newTeemTestServer(t *testing.T, versions http.HandlerFunc) (*httptest.Server, *int) {
+	calls := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/cli/version") || strings.HasSuffix(r.URL.Path, "/appsvcs/info"):
+			if versions != nil {
+				versions(w, r)
+				return
+			}
+			w.Write([]byte(`{"version":"3.40.0","entries":{"https://localhost/mgmt/tm/cli/version/0":{"nestedStats":{"entries":{"active":{"description":"8.3.0"}}}}}}`))
+			return
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/member-management"):
+			calls++
+			w.Write([]byte(`{"id":"task-1","status":"STARTED","address":"10.9.8.7","licenseText":"SECRET-LICENSE"}`))
+			return
+		}
+		calls++
+		w.Write([]byte(`{"licenseText":"SECRET-LICENSE"}`))
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func runTeemOperations(t *testing.T, b *BigIQ) {
+	_, err := b.PostLicense(&LicenseParam{Command: LicenseAssign, Address: "10.9.8.7", AssignmentType: AssignmentUnmanaged, User: "admin", Password: "hunter2"})
+	assert.Nil(t, err)
+	_, err = b.PostLicense(&LicenseParam{Command: LicenseRevoke, Address: "10.9.8.7", AssignmentType: AssignmentUnmanaged, User: "admin", Password: "hunter2"})
+	assert.Nil(t, err)
+	assert.Nil(t, b.RegkeylicenseRevoke("pool-1", "AAAAA-BBBBB-CCCCC-DDDDD-EEEEEEE", "member-1"))
+	err, _ = b.PostAs3Bigiq(teemDeclaration)
+	assert.Nil(t, err)
+	err, _ = b.DeleteAs3Bigiq(teemDeclaration, "Secret_Tenant")
+	assert.Nil(t, err)
+}
+
+func readTeemRecords(t *testing.T, out *bytes.Buffer) []TeemRecord {
+	var records []TeemRecord
+	scanner := bufio.NewScanner(bytes.NewReader(out.Bytes()))
+	for scanner.Scan() {
+		var r TeemRecord
+		assert.Nil(t, json.Unmarshal(scanner.Bytes(), &r))
+		records = append(records, r)
+	}
+	return records
+}
+
+func TestTeemDisabledIsNoop(t *testing.T) {
+	server, calls := newTeemTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("version looked up with telemetry off: %s", r.URL.Path)
+	})
+	var out bytes.Buffer
+	b := NewSession(server.URL, "", "", "", nil)
+	b.TeemSink = NewWriterTeemSink(&out)
+
+	runTeemOperations(t, b)
+
+	assert.Equal(t, 0, out.Len())
+	assert.Nil(t, b.teem)
+	assert.Equal(t, 6, *calls)
+}
+
+func TestTeemRecordsEachOperationWithoutPayloads(t *testing.T) {
+	server, _ := newTeemTestServer(t, nil)
+	var out bytes.Buffer
+	b := NewSession(server.URL, "", "", "", nil)
+	b.Teem = true
+	b.TeemSink = NewWriterTeemSink(&out)
+	// Look the versions up before the operations run, so every record has them.
+	b.recordTeem("warm-up", time.Now(), nil)
+	b.recordTeem(TeemAS3Deploy, time.Now(), nil)
+	b.teem.lookups.Wait()
+	out.Reset()
+
+	runTeemOperations(t, b)
+
+	records := readTeemRecords(t, &out)
+	var operations []string
+	for _, r := range records {
+		operations = append(operations, r.Operation)
+		assert.True(t, r.Success)
+		assert.Equal(t, "8.3.0", r.BigIQVersion)
+		assert.Equal(t, LibraryVersion, r.LibraryVersion)
+	}
+	assert.Equal(t, []string{TeemLicenseAssign, TeemLicenseRevoke, TeemLicenseRevoke, TeemAS3Deploy, TeemAS3Delete}, operations)
+	assert.Equal(t, int64(2), records[2].Count)
+	assert.Equal(t, "3.40.0", records[3].AS3Version)
+	assert.Equal(t, "", records[0].AS3Version)
+	for _, secret := range []string{"10.9.8.7", "hunter2", "admin", "AAAAA-BBBBB", "SECRET-LICENSE", "Secret_Tenant", "pool-1", "member-1"} {
+		assert.NotContains(t, out.String(), secret)
+	}
+}
+
+func TestTeemVersionLookupIsLazyAndRetried(t *testing.T) {
+	defer func(retry time.Duration) { teemVersionRetry = retry }(teemVersionRetry)
+	teemVersionRetry = 0
+	release := make(chan struct{})
+	lookups := 0
+	server, _ := newTeemTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		lookups++
+		if lookups == 1 {
+			// The first lookup hangs and then fails.
+			<-release
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"code":500,"message":"restjavad restarting"}`))
+			return
+		}
+		w.Write([]byte(`{"entries":{"https://localhost/mgmt/tm/cli/version/0":{"nestedStats":{"entries":{"active":{"description":"8.3.0"}}}}}}`))
+	})
+	var out bytes.Buffer
+	b := NewSession(server.URL, "", "", "", nil)
+	b.Teem = true
+	b.TeemSink = NewWriterTeemSink(&out)
+
+	// The operation is reported while the lookup is still hanging.
+	b.recordTeem(TeemLicenseAssign, time.Now(), nil)
+	assert.Equal(t, 1, len(readTeemRecords(t, &out)))
+	close(release)
+	b.teem.lookups.Wait()
+
+	b.recordTeem(TeemLicenseAssign, time.Now(), nil)
+	b.teem.lookups.Wait()
+	b.recordTeem(TeemLicenseAssign, time.Now(), nil)
+
+	records := readTeemRecords(t, &out)
+	assert.Equal(t, 3, len(records))
+	assert.Equal(t, "", records[0].BigIQVersion)
+	assert.Equal(t, "", records[1].BigIQVersion)
+	assert.Equal(t, "8.3.0", records[2].BigIQVersion)
+	assert.Equal(t, 2, lookups)
+}
@@ -0,0 +1,206 @@
+package bigiq
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	uriUtilityBilling = "utility-billing-reports"
+
+	usageReportPollInterval = 5 * time.Second
+	usageReportDateFormat   = "2006-01-02"
+)
+
+// UsageReportRequest selects the utility license and billing period of a
+// usage report.
+type UsageReportRequest struct {
+	RegKey string
+	Start  time.Time
+	End    time.Time
+}
+
+// usageReportTask is the utility billing report task. BIG-IQ sets ReportURI
+// once the task has FINISHED.
+type usageReportTask struct {
+	ID                string `json:"id,omitempty"`
+	RegKey            string `json:"regKey"`
+	SubmissionMethod  string `json:"submissionMethod,omitempty"`
+	ManuallySubmitted bool   `json:"manuallySubmitted"`
+	StartDate         string `json:"startDate,omitempty"`
+	EndDate           string `json:"endDate,omitempty"`
+	Status            string `json:"status,omitempty"`
+	ErrorMessage      string `json:"errorMessage,omitempty"`
+	ReportURI         string `json:"reportUri,omitempty"`
+}
+
+// UsageRecord is the metered usage of one device under one offering.
+type UsageRecord struct {
+	Device        string  `json:"device"`
+	DeviceAddress string  `json:"deviceAddress,omitempty"`
+	Offering      string  `json:"offering"`
+	UnitOfMeasure string  `json:"unitOfMeasure"`
+	Used          float64 `json:"used"`
+}
+
+// UsageReport is a downloaded utility billing report. Raw holds the report
+// exactly as BIG-IQ produced it, which is what has to be submitted to F5.
+type UsageReport struct {
+	RegKey  string        `json:"regKey"`
+	Start   string        `json:"startDate,omitempty"`
+	End     string        `json:"endDate,omitempty"`
+	Records []UsageRecord `json:"records"`
+	Raw     []byte        `json:"-"`
+}
+
+// usageReportDoc is the part of the report document that is parsed into
+// UsageRecords.
+type usageReportDoc struct {
+	Offerings []struct {
+		Name  string `json:"name"`
+		Usage []struct {
+			DeviceName    string  `json:"deviceName"`
+			DeviceAddress string  `json:"deviceAddress"`
+			UnitOfMeasure string  `json:"unitOfMeasure"`
+			Quantity      float64 `json:"quantity"`
+		} `json:"usage"`
+	} `json:"offerings"`
+}
+
+// GenerateUsageReport starts BIG-IQ's utility billing report task for
+// req.RegKey over [req.Start, req.End], waits for it and downloads and parses
+// the report. A zero Start or End leaves that bound to BIG-IQ.
+func (b *BigIQ) GenerateUsageReport(ctx context.Context, req UsageReportRequest) (*UsageReport, error) {
+	task := usageReportTask{
+		RegKey:           req.RegKey,
+		SubmissionMethod: "Manual",
+	}
+	if !req.Start.IsZero() {
+		task.StartDate = req.Start.Format(usageReportDateFormat)
+	}
+	if !req.End.IsZero() {
+		task.EndDate = req.End.Format(usageReportDateFormat)
+	}
+	resp, err := b.postReq(task, uriMgmt, uriCm, uriDevice, uriTasks, uriLicensing, uriUtilityBilling)
+	if err != nil {
+		return nil, err
+	}
+	var created usageReportTask
+	if err := json.Unmarshal(resp, &created); err != nil {
+		return nil, err
+	}
+	if created.ID == "" {
+		return nil, fmt.Errorf("usage report task for %s was created without an ID", req.RegKey)
+	}
+	start := time.Now()
+	err = b.pollTask(ctx, TaskUsageReport, usageReportPollInterval, func() (bool, error) {
+		task = usageReportTask{}
+		err, ok := b.getForEntity(&task, uriMgmt, uriCm, uriDevice, uriTasks, uriLicensing, uriUtilityBilling, created.ID)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			// The task is not visible immediately after it is posted.
+			if time.Since(start) > licenseTaskGrace {
+				return false, fmt.Errorf("usage report task %s not found", created.ID)
+			}
+			return false, nil
+		}
+		switch task.Status {
+		case "FINISHED":
+			return true, nil
+		case "FAILED":
+			return false, fmt.Errorf("usage report for %s failed: %s", req.RegKey, task.ErrorMessage)
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if task.ReportURI == "" {
+		return nil, fmt.Errorf("usage report for %s finished without a report", req.RegKey)
+	}
+	raw, err := b.downloadReport(task.ReportURI)
+	if err != nil {
+		return nil, err
+	}
+	report, err := ParseUsageReport(raw)
+	if err != nil {
+		return nil, err
+	}
+	report.RegKey = req.RegKey
+	report.Start = task.StartDate
+	report.End = task.EndDate
+	return report, nil
+}
+
+// linkPath returns the path parts of link, which BIG-IQ gives either as a
+// path or as a link such as https://localhost/mgmt/....
+func linkPath(link string) []string {
+	path := link
+	if u, err := url.Parse(link); err == nil {
+		path = u.Path
+	}
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
+
+func (b *BigIQ) downloadReport(reportURI string) ([]byte, error) {
+	req := &APIRequest{
+		Method:      "get",
+		URL:         b.iControlPath(linkPath(reportURI)),
+		ContentType: "application/json",
+	}
+	data, _, err := b.apiCall(req)
+	return data, err
+}
+
+// ParseUsageReport parses a utility billing report as downloaded from BIG-IQ.
+func ParseUsageReport(raw []byte) (*UsageReport, error) {
+	var doc usageReportDoc
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("parsing usage report: %v", err)
+	}
+	report := &UsageReport{Records: []UsageRecord{}, Raw: raw}
+	for _, o := range doc.Offerings {
+		for _, u := range o.Usage {
+			report.Records = append(report.Records, UsageRecord{
+				Device:        deviceLabel(u.DeviceName, u.DeviceAddress),
+				DeviceAddress: u.DeviceAddress,
+				Offering:      o.Name,
+				UnitOfMeasure: u.UnitOfMeasure,
+				Used:          u.Quantity,
+			})
+		}
+	}
+	return report, nil
+}
+
+// WriteJSON writes the parsed report to w as indented JSON.
+func (r *UsageReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteCSV writes one row per usage record to w, with a header row.
+func (r *UsageReport) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"DEVICE", "DEVICE ADDRESS", "OFFERING", "UNIT OF MEASURE", "USED"}); err != nil {
+		return err
+	}
+	for _, rec := range r.Records {
+		row := []string{rec.Device, rec.DeviceAddress, rec.Offering, rec.UnitOfMeasure, strconv.FormatFloat(rec.Used, 'f', -1, 64)}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
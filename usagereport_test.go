@@ -0,0 +1,119 @@
+package bigiq
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testUsageReport = `{"offerings":[{"name":"F5-BIG-MSP-BT-10G","usage":[
+	{"deviceName":"bigip1","deviceAddress":"10.0.0.1","unitOfMeasure":"hourly","quantity":720},
+	{"deviceAddress":"10.0.0.2","unitOfMeasure":"daily","quantity":30}]}]}`
+
+func TestGenerateUsageReport(t *testing.T) {
+	var body string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodPost:
+			buf := new(bytes.Buffer)
+			buf.ReadFrom(r.Body)
+			body = buf.String()
+			w.Write([]byte(`{"id":"task-1","status":"STARTED"}`))
+		case strings.HasSuffix(r.URL.Path, "/utility-billing-reports/task-1"):
+			w.Write([]byte(`{"id":"task-1","status":"FINISHED","startDate":"2026-09-01","endDate":"2026-09-30","reportUri":"/mgmt/cm/device/licensing/license-reports-download/report.json"}`))
+		case r.URL.Path == "/mgmt/cm/device/licensing/license-reports-download/report.json":
+			w.Write([]byte(testUsageReport))
+		}
+	}))
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+
+	report, err := b.GenerateUsageReport(context.Background(), UsageReportRequest{
+		RegKey: "REGKEY",
+		Start:  time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC),
+		End:    time.Date(2026, 9, 30, 0, 0, 0, 0, time.UTC),
+	})
+
+	assert.Nil(t, err)
+	assert.Contains(t, body, `"startDate":"2026-09-01"`)
+	assert.Equal(t, "REGKEY", report.RegKey)
+	assert.Equal(t, []UsageRecord{
+		{Device: "bigip1", DeviceAddress: "10.0.0.1", Offering: "F5-BIG-MSP-BT-10G", UnitOfMeasure: "hourly", Used: 720},
+		{Device: "10.0.0.2", DeviceAddress: "10.0.0.2", Offering: "F5-BIG-MSP-BT-10G", UnitOfMeasure: "daily", Used: 30},
+	}, report.Records)
+
+	var out bytes.Buffer
+	assert.Nil(t, report.WriteCSV(&out))
+	assert.Contains(t, out.String(), "bigip1,10.0.0.1,F5-BIG-MSP-BT-10G,hourly,720\n")
+}
+
+func TestGenerateUsageReportFollowsReportLink(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodPost:
+			w.Write([]byte(`{"id":"task-1","status":"STARTED"}`))
+		case strings.HasSuffix(r.URL.Path, "/utility-billing-reports/task-1"):
+			w.Write([]byte(`{"id":"task-1","status":"FINISHED","reportUri":"https://localhost/mgmt/cm/device/licensing/license-reports-download/report.json"}`))
+		case r.URL.Path == "/mgmt/cm/device/licensing/license-reports-download/report.json":
+			w.Write([]byte(testUsageReport))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"code":404,"message":"not found"}`))
+		}
+	}))
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+
+	report, err := b.GenerateUsageReport(context.Background(), UsageReportRequest{RegKey: "REGKEY"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(report.Records))
+}
+
+func TestGenerateUsageReportRejectsTaskWithoutID(t *testing.T) {
+	gets := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodGet {
+			gets++
+		}
+		w.Write([]byte(`{"status":"STARTED"}`))
+	}))
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+
+	_, err := b.GenerateUsageReport(context.Background(), UsageReportRequest{RegKey: "REGKEY"})
+
+	assert.Contains(t, err.Error(), "without an ID")
+	assert.Equal(t, 0, gets)
+}
+
+func TestGenerateUsageReportFailsWhenTaskStaysMissing(t *testing.T) {
+	defer func(grace time.Duration) { licenseTaskGrace = grace }(licenseTaskGrace)
+	licenseTaskGrace = 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodPost {
+			w.Write([]byte(`{"id":"task-1","status":"STARTED"}`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"code":404,"message":"not found"}`))
+	}))
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	_, err := b.GenerateUsageReport(ctx, UsageReportRequest{RegKey: "REGKEY"})
+
+	assert.Equal(t, "usage report task task-1 not found", err.Error())
+}
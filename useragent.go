@@ -0,0 +1,56 @@
+package bigiq
+
+import (
+	"net/http"
+	"strings"
+)
+
+// LibraryVersion is the version of go-bigiq reported in the User-Agent header.
+const LibraryVersion = "0.1.1"
+
+// DefaultCorrelationHeader is the header used to send BigIQ.CorrelationID when
+// BigIQ.CorrelationHeader is empty.
+const DefaultCorrelationHeader = "X-Correlation-ID"
+
+// HTTPUserAgent returns the User-Agent sent with every request. It is made up
+// of the library version, the session's UserAgent and ProductTokens, and the
+// correlation ID when one is set, e.g.
+// "go-bigiq/0.1.1 Terraform/1.3.0 my-pipeline/2 (correlation-id=run-42)".
+func (b *BigIQ) HTTPUserAgent() string {
+	tokens := []string{"go-bigiq/" + LibraryVersion}
+	if b.UserAgent != "" {
+		tokens = append(tokens, b.UserAgent)
+	}
+	for _, t := range b.ProductTokens {
+		if t = strings.TrimSpace(t); t != "" {
+			tokens = append(tokens, t)
+		}
+	}
+	if b.CorrelationID != "" {
+		tokens = append(tokens, "(correlation-id="+b.CorrelationID+")")
+	}
+	return strings.Join(tokens, " ")
+}
+
+// WithCorrelationID returns a copy of the session that sends id in the
+// correlation header and User-Agent of every request it makes. The copy
+// shares the transport, token, cache and metrics of the original, so it can
+// be used to tag the requests of a single job or request in the caller's own
+// logs.
+func (b *BigIQ) WithCorrelationID(id string) *BigIQ {
+	c := *b
+	c.CorrelationID = id
+	return &c
+}
+
+// setClientHeaders adds the User-Agent and correlation headers to req.
+func (b *BigIQ) setClientHeaders(req *http.Request) {
+	req.Header.Set("User-Agent", b.HTTPUserAgent())
+	if b.CorrelationID != "" {
+		header := b.CorrelationHeader
+		if header == "" {
+			header = DefaultCorrelationHeader
+		}
+		req.Header.Set(header, b.CorrelationID)
+	}
+}
@@ -0,0 +1,61 @@
+package bigiq
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newHeaderTestServer(t *testing.T) (*httptest.Server, *[]http.Header) {
+	var headers []http.Header
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = append(headers, r.Header.Clone())
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(server.Close)
+	return server, &headers
+}
+
+func TestDefaultUserAgent(t *testing.T) {
+	server, headers := newHeaderTestServer(t)
+	b := NewSession(server.URL, "", "", "", nil)
+
+	_, err := b.APICall(&APIRequest{Method: "get", URL: "mgmt/shared/echo"})
+	assert.Nil(t, err)
+	_, err = b.UploadBytes([]byte("data"), "file.txt")
+	assert.Nil(t, err)
+
+	assert.Equal(t, 2, len(*headers))
+	for _, h := range *headers {
+		assert.Equal(t, "go-bigiq/"+LibraryVersion, h.Get("User-Agent"))
+		assert.Equal(t, "", h.Get(DefaultCorrelationHeader))
+	}
+}
+
+func TestUserAgentSuffixAndCorrelationID(t *testing.T) {
+	server, headers := newHeaderTestServer(t)
+	b := NewSession(server.URL, "", "", "", nil)
+	b.UserAgent = "Terraform/1.3.0"
+	b.ProductTokens = []string{"my-pipeline/2"}
+	job := b.WithCorrelationID("run-42")
+	job.CorrelationHeader = "X-Request-ID"
+
+	_, err := job.APICall(&APIRequest{Method: "get", URL: "mgmt/shared/echo"})
+	assert.Nil(t, err)
+	_, err = job.UploadBytes([]byte("data"), "file.txt")
+	assert.Nil(t, err)
+	_, err = b.APICall(&APIRequest{Method: "get", URL: "mgmt/shared/echo"})
+	assert.Nil(t, err)
+
+	assert.Equal(t, 3, len(*headers))
+	for _, h := range (*headers)[:2] {
+		assert.Equal(t, "go-bigiq/"+LibraryVersion+" Terraform/1.3.0 my-pipeline/2 (correlation-id=run-42)", h.Get("User-Agent"))
+		assert.Equal(t, "run-42", h.Get("X-Request-ID"))
+	}
+	// The original session is not tagged.
+	assert.Equal(t, "go-bigiq/"+LibraryVersion+" Terraform/1.3.0 my-pipeline/2", (*headers)[2].Get("User-Agent"))
+	assert.Equal(t, "", (*headers)[2].Get("X-Request-ID"))
+}
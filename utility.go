@@ -10,9 +10,14 @@ See the License for the specific language governing permissions and limitations
 */
 package bigiq
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
 
-//  LIC contains device license for BIG-IP system.
+// LIC contains device license for BIG-IP system.
 type ULICs struct {
 	LIC []LIC `json:"items"`
 }
@@ -82,20 +87,265 @@ func (p *ULIC) UnmarshalJSON(b []byte) error {
 	return marshal(p, &dto)
 }
 
+// Units of measure accepted when assigning a utility license.
+const (
+	UnitHourly  = "hourly"
+	UnitDaily   = "daily"
+	UnitMonthly = "monthly"
+	UnitYearly  = "yearly"
+)
+
+// UtilityLicense is a utility (metered) license installed on BIG-IQ.
+type UtilityLicense struct {
+	RegKey          string `json:"regKey"`
+	Name            string `json:"name,omitempty"`
+	Status          string `json:"status,omitempty"`
+	ExpiresDateTime string `json:"expiresDateTime,omitempty"`
+	SelfLink        string `json:"selfLink,omitempty"`
+}
+
+type utilityLicenses struct {
+	Items []UtilityLicense `json:"items"`
+}
+
+// UtilityOffering is one of the offerings of a utility license. Name is the
+// offering SKU, e.g. F5-BIG-MSP-BT-10G.
+type UtilityOffering struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Status      string `json:"status,omitempty"`
+	// Capacity is the number of devices the offering can license, when
+	// BIG-IQ reports it.
+	Capacity int    `json:"capacity,omitempty"`
+	SelfLink string `json:"selfLink,omitempty"`
+}
+
+type utilityOfferings struct {
+	Items []UtilityOffering `json:"items"`
+}
+
+// UtilityMember is a device licensed from a utility offering.
+type UtilityMember struct {
+	ID               string              `json:"id"`
+	DeviceAddress    string              `json:"deviceAddress,omitempty"`
+	DeviceName       string              `json:"deviceName,omitempty"`
+	DeviceMachineID  string              `json:"deviceMachineId,omitempty"`
+	DeviceReference  DeviceRef           `json:"deviceReference,omitempty"`
+	MacAddress       string              `json:"macAddress,omitempty"`
+	LastUpdateMicros int64               `json:"lastUpdateMicros,omitempty"`
+	UnitOfMeasure    string              `json:"unitOfMeasure,omitempty"`
+	Status           LicenseMemberStatus `json:"status,omitempty"`
+	Message          string              `json:"message,omitempty"`
+	SelfLink         string              `json:"selfLink,omitempty"`
+}
+
+type utilityMembers struct {
+	Items []UtilityMember `json:"items"`
+}
+
+func utilityLicensePath(parts ...string) []string {
+	return append([]string{uriMgmt, uriCm, uriDiv, uriLins, uriPoo, uriUtility, uriLicn}, parts...)
+}
+
+func validUnitOfMeasure(unit string) bool {
+	switch unit {
+	case UnitHourly, UnitDaily, UnitMonthly, UnitYearly:
+		return true
+	}
+	return false
+}
+
+// UtilityLicenses returns the utility licenses installed on BIG-IQ.
+func (b *BigIQ) UtilityLicenses() ([]UtilityLicense, error) {
+	var licenses utilityLicenses
+	err, _ := b.getForEntityCached(&licenses, utilityLicensePath()...)
+	if err != nil {
+		return nil, err
+	}
+	return licenses.Items, nil
+}
+
+// UtilityLicense returns the utility license with the given regkey.
+func (b *BigIQ) UtilityLicense(regkey string) (*UtilityLicense, error) {
+	var license UtilityLicense
+	err, ok := b.getForEntity(&license, utilityLicensePath(regkey)...)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("utility license %s not found", regkey)
+	}
+	return &license, nil
+}
+
+// UtilityOfferings returns the offerings of the utility license regkey.
+func (b *BigIQ) UtilityOfferings(regkey string) ([]UtilityOffering, error) {
+	var offerings utilityOfferings
+	err, ok := b.getForEntityCached(&offerings, utilityLicensePath(regkey, uriOfferings)...)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("utility license %s not found", regkey)
+	}
+	return offerings.Items, nil
+}
+
+// FindUtilityOffering returns the offering of regkey whose name is offering
+// or, failing that, the single offering whose name or description contains
+// offering as a case-insensitive keyword (e.g. "BT-10G").
+func (b *BigIQ) FindUtilityOffering(regkey, offering string) (*UtilityOffering, error) {
+	offerings, err := b.UtilityOfferings(regkey)
+	if err != nil {
+		return nil, err
+	}
+	return matchUtilityOffering(regkey, offerings, offering)
+}
+
+func matchUtilityOffering(regkey string, offerings []UtilityOffering, offering string) (*UtilityOffering, error) {
+	for i := range offerings {
+		if strings.EqualFold(offerings[i].Name, offering) || offerings[i].ID == offering {
+			return &offerings[i], nil
+		}
+	}
+	keyword := strings.ToLower(offering)
+	var matches []*UtilityOffering
+	for i := range offerings {
+		if strings.Contains(strings.ToLower(offerings[i].Name), keyword) ||
+			strings.Contains(strings.ToLower(offerings[i].Description), keyword) {
+			matches = append(matches, &offerings[i])
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no offering matching %q in utility license %s", offering, regkey)
+	case 1:
+		return matches[0], nil
+	}
+	names := make([]string, len(matches))
+	for i, m := range matches {
+		names[i] = m.Name
+	}
+	return nil, fmt.Errorf("offering %q is ambiguous in utility license %s: %s", offering, regkey, strings.Join(names, ", "))
+}
+
+// UtilityOfferingMembers returns the devices licensed from the named offering
+// of the utility license regkey.
+func (b *BigIQ) UtilityOfferingMembers(regkey, offering string) ([]UtilityMember, error) {
+	o, err := b.FindUtilityOffering(regkey, offering)
+	if err != nil {
+		return nil, err
+	}
+	var members utilityMembers
+	err, _ = b.getForEntity(&members, utilityLicensePath(regkey, uriOfferings, o.ID, uriMemb)...)
+	if err != nil {
+		return nil, err
+	}
+	return members.Items, nil
+}
+
+// AssignUtilityLicense licenses device from the named offering of the utility
+// license regkey, billed per unitOfMeasure (UnitHourly, UnitDaily,
+// UnitMonthly or UnitYearly). device is a ManagedDevice or an
+// UnmanagedDevice.
+func (b *BigIQ) AssignUtilityLicense(regkey, offering, unitOfMeasure string, device interface{}) (member *UtilityMember, err error) {
+	start := time.Now()
+	defer func() { b.recordTeem(TeemLicenseAssign, start, err) }()
+	if !validUnitOfMeasure(unitOfMeasure) {
+		return nil, fmt.Errorf("invalid unit of measure %q", unitOfMeasure)
+	}
+	body, err := newMemberRequest(device)
+	if err != nil {
+		return nil, err
+	}
+	body.UnitOfMeasure = unitOfMeasure
+	o, err := b.FindUtilityOffering(regkey, offering)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := b.postReq(body, utilityLicensePath(regkey, uriOfferings, o.ID, uriMemb)...)
+	if err != nil {
+		return nil, err
+	}
+	member = &UtilityMember{}
+	if err = json.Unmarshal(resp, member); err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+// RevokeUtilityLicense revokes the license of the device at deviceAddress
+// from the named offering of the utility license regkey. credentials are
+// required for unmanaged devices and may be nil for managed ones.
+func (b *BigIQ) RevokeUtilityLicense(regkey, offering, deviceAddress string, credentials *UnmanagedDevice) (err error) {
+	start := time.Now()
+	defer func() { b.recordTeem(TeemLicenseRevoke, start, err) }()
+	o, err := b.FindUtilityOffering(regkey, offering)
+	if err != nil {
+		return err
+	}
+	var members utilityMembers
+	err, _ = b.getForEntity(&members, utilityLicensePath(regkey, uriOfferings, o.ID, uriMemb)...)
+	if err != nil {
+		return err
+	}
+	for _, m := range members.Items {
+		if m.DeviceAddress == deviceAddress {
+			return b.revokeMember(m.ID, credentials, utilityLicensePath(regkey, uriOfferings, o.ID, uriMemb, m.ID)...)
+		}
+	}
+	return fmt.Errorf("device %s is not licensed from offering %s of utility license %s", deviceAddress, o.Name, regkey)
+}
+
 // Get the RegKey which is used to know what Bulk license is available on BIG-IQ
 func (b *BigIQ) getUtilityPool() (*UtilityPool, error) {
 	var utilityPool UtilityPool
-	err, _ := b.getForEntity(&utilityPool, uriMgmt, uriCm, uriDiv, uriLins, uriPoo, uriUtility, uriLicn)
+	err, _ := b.getForEntityCached(&utilityPool, utilityLicensePath()...)
 	if err != nil {
 		return nil, err
 	}
-	// for loop over all returned license pools to check which one has available licenses
-	// getAvailablePool(member[index_of_array].Uuid)
-	// At the end change return statement to return only the UUID string of the one where license
-	// is available
+	if len(utilityPool.Items) == 0 {
+		return nil, fmt.Errorf("no utility licenses found")
+	}
 	return &utilityPool, nil
 }
 
+// The offering CreateULIC and DeleteULIC addressed by ID before offerings
+// were discovered. They still prefer it.
+const (
+	legacyUtilityOfferingID   = "f37c66e0-a80d-43e8-924b-3bbe9fe96bbe"
+	legacyUtilityOfferingName = "F5-BIG-MSP-BT-10G"
+)
+
+// defaultUtilityOffering returns the first utility license and the named
+// offering of it. Without a name it returns the F5-BIG-MSP-BT-10G offering if
+// the license has one, and its first offering otherwise.
+func (b *BigIQ) defaultUtilityOffering(offering string) (string, *UtilityOffering, error) {
+	utilityPool, err := b.getUtilityPool()
+	if err != nil {
+		return "", nil, err
+	}
+	regkey := utilityPool.Items[0].RegKey
+	offerings, err := b.UtilityOfferings(regkey)
+	if err != nil {
+		return "", nil, err
+	}
+	if offering != "" {
+		o, err := matchUtilityOffering(regkey, offerings, offering)
+		return regkey, o, err
+	}
+	if len(offerings) == 0 {
+		return "", nil, fmt.Errorf("utility license %s has no offerings", regkey)
+	}
+	for i := range offerings {
+		if offerings[i].ID == legacyUtilityOfferingID || strings.EqualFold(offerings[i].Name, legacyUtilityOfferingName) {
+			return regkey, &offerings[i], nil
+		}
+	}
+	return regkey, &offerings[0], nil
+}
+
 // Function to get the RegKey
 func (b *BigIQ) ULIC() (*ULIC, error) {
 	var va ULIC
@@ -103,27 +353,34 @@ func (b *BigIQ) ULIC() (*ULIC, error) {
 	if utilityPoolErr != nil {
 		return nil, utilityPoolErr
 	}
-	err, _ := b.getForEntity(&va, uriMgmt, uriCm, uriDiv, uriLins, uriPoo, uriUtility, uriLicn, utilityPool.Items[0].RegKey)
+	err, _ := b.getForEntity(&va, utilityLicensePath(utilityPool.Items[0].RegKey)...)
 	if err != nil {
 		return nil, err
 	}
 	return &va, nil
 }
 
+// CreateULIC licenses an unmanaged device from the F5-BIG-MSP-BT-10G, or
+// else the first, offering of the first utility license. Use
+// CreateULICFromOffering or AssignUtilityLicense to choose the offering.
 func (b *BigIQ) CreateULIC(deviceAddress string, username string, password string, unitOfMeasure string) error {
-	config := &ULIC{
+	return b.CreateULICFromOffering("", deviceAddress, username, password, unitOfMeasure)
+}
+
+// CreateULICFromOffering licenses an unmanaged device from the named offering
+// of the first utility license, as FindUtilityOffering matches it.
+func (b *BigIQ) CreateULICFromOffering(offering, deviceAddress, username, password, unitOfMeasure string) error {
+	regkey, o, err := b.defaultUtilityOffering(offering)
+	if err != nil {
+		return err
+	}
+	device := UnmanagedDevice{
 		DeviceAddress: deviceAddress,
 		Username:      username,
 		Password:      password,
-		UnitOfMeasure: unitOfMeasure,
 	}
-
-	utilityPool, utilityPoolErr := b.getUtilityPool()
-	if utilityPoolErr != nil {
-		return utilityPoolErr
-	}
-
-	return b.post(config, uriMgmt, uriCm, uriDiv, uriLins, uriPoo, uriUtility, uriLicn, utilityPool.Items[0].RegKey, uriOfferings, uriF5BIGMSPBT10G, uriMemb)
+	_, err = b.AssignUtilityLicense(regkey, o.ID, unitOfMeasure, device)
+	return err
 }
 
 func (b *BigIQ) ModifyULIC(config *ULIC) error {
@@ -131,7 +388,7 @@ func (b *BigIQ) ModifyULIC(config *ULIC) error {
 	if utilityPoolErr != nil {
 		return utilityPoolErr
 	}
-	return b.patch(config, uriMgmt, uriCm, uriDiv, uriLins, uriPoo, uriUtility, uriLicn, utilityPool.Items[0].RegKey, uriMemb)
+	return b.patch(config, utilityLicensePath(utilityPool.Items[0].RegKey, uriMemb)...)
 }
 
 func (b *BigIQ) ULICs() (*ULIC, error) {
@@ -140,7 +397,7 @@ func (b *BigIQ) ULICs() (*ULIC, error) {
 	if utilityPoolErr != nil {
 		return nil, utilityPoolErr
 	}
-	err, _ := b.getForEntity(&members, uriMgmt, uriCm, uriDiv, uriLins, uriPoo, uriUtility, uriLicn, utilityPool.Items[0].RegKey, uriMemb)
+	err, _ := b.getForEntity(&members, utilityLicensePath(utilityPool.Items[0].RegKey, uriMemb)...)
 
 	if err != nil {
 		return nil, err
@@ -149,12 +406,20 @@ func (b *BigIQ) ULICs() (*ULIC, error) {
 	return &members, nil
 }
 
+// DeleteULIC revokes the license of config.DeviceAddress from the offering
+// CreateULIC uses. Use DeleteULICFromOffering or RevokeUtilityLicense to
+// choose the offering.
 func (b *BigIQ) DeleteULIC(config *ULIC) error {
+	return b.DeleteULICFromOffering("", config)
+}
 
-	utilityPool, utilityPoolErr := b.getUtilityPool()
-	if utilityPoolErr != nil {
-		return utilityPoolErr
+// DeleteULICFromOffering revokes the license of config.DeviceAddress from the
+// named offering of the first utility license.
+func (b *BigIQ) DeleteULICFromOffering(offering string, config *ULIC) error {
+	regkey, o, err := b.defaultUtilityOffering(offering)
+	if err != nil {
+		return err
 	}
-
-	return b.delete(uriMgmt, uriCm, uriDiv, uriLins, uriPoo, uriUtility, uriLicn, utilityPool.Items[0].RegKey, uriOfferings, uriF5BIGMSPBT10G, uriMemb)
+	credentials := &UnmanagedDevice{Username: config.Username, Password: config.Password}
+	return b.RevokeUtilityLicense(regkey, o.ID, config.DeviceAddress, credentials)
 }
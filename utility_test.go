@@ -0,0 +1,97 @@
+package bigiq
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAssignUtilityLicenseResolvesOffering(t *testing.T) {
+	var posted memberRequest
+	var postPath string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/offerings"):
+			w.Write([]byte(`{"items":[
+				{"id":"1111","name":"F5-BIG-MSP-BT-10G","description":"BIG-IP Better 10Gbps"},
+				{"id":"2222","name":"F5-BIG-MSP-BT-1G","description":"BIG-IP Better 1Gbps"}]}`))
+		case r.Method == http.MethodPost:
+			postPath = r.URL.Path
+			json.NewDecoder(r.Body).Decode(&posted)
+			w.Write([]byte(`{"id":"m1","deviceAddress":"10.0.0.1","status":"INSTALLING"}`))
+		}
+	}))
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+
+	member, err := b.AssignUtilityLicense("REGKEY", "bt-10g", UnitYearly, UnmanagedDevice{DeviceAddress: "10.0.0.1", Username: "admin", Password: "secret"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "m1", member.ID)
+	assert.Equal(t, "/mgmt/cm/device/licensing/pool/utility/licenses/REGKEY/offerings/1111/members", postPath)
+	assert.Equal(t, UnitYearly, posted.UnitOfMeasure)
+	assert.Equal(t, "10.0.0.1", posted.DeviceAddress)
+	assert.Nil(t, posted.DeviceReference)
+}
+
+func TestMatchUtilityOfferingAmbiguous(t *testing.T) {
+	offerings := []UtilityOffering{{ID: "1", Name: "F5-BIG-MSP-BT-10G"}, {ID: "2", Name: "F5-BIG-MSP-BT-1G"}}
+
+	_, err := matchUtilityOffering("REGKEY", offerings, "MSP-BT")
+	assert.Contains(t, err.Error(), "ambiguous")
+
+	o, err := matchUtilityOffering("REGKEY", offerings, "f5-big-msp-bt-1g")
+	assert.Nil(t, err)
+	assert.Equal(t, "2", o.ID)
+}
+
+func utilityOfferingsServer(requests *[]string) *httptest.Server {
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		*requests = append(*requests, r.Method+" "+r.URL.Path)
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/utility/licenses"):
+			w.Write([]byte(`{"items":[{"regKey":"REGKEY"}]}`))
+		case strings.HasSuffix(r.URL.Path, "/offerings"):
+			w.Write([]byte(`{"items":[
+				{"id":"2222","name":"F5-BIG-MSP-BT-1G"},
+				{"id":"f37c66e0-a80d-43e8-924b-3bbe9fe96bbe","name":"F5-BIG-MSP-BT-10G"}]}`))
+		case strings.HasSuffix(r.URL.Path, "/members") && r.Method == http.MethodGet:
+			w.Write([]byte(`{"items":[{"id":"m1","deviceAddress":"10.0.0.1"}]}`))
+		default:
+			w.Write([]byte(`{"id":"m1","deviceAddress":"10.0.0.1"}`))
+		}
+	}))
+}
+
+func TestCreateULICKeepsLegacyOfferingWithSeveralOfferings(t *testing.T) {
+	var requests []string
+	server := utilityOfferingsServer(&requests)
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+
+	err := b.CreateULIC("10.0.0.1", "admin", "secret", UnitYearly)
+
+	assert.Nil(t, err)
+	assert.Contains(t, requests, "POST /mgmt/cm/device/licensing/pool/utility/licenses/REGKEY/offerings/f37c66e0-a80d-43e8-924b-3bbe9fe96bbe/members")
+}
+
+func TestULICFromOffering(t *testing.T) {
+	var requests []string
+	server := utilityOfferingsServer(&requests)
+	defer server.Close()
+	b := NewSession(server.URL, "", "", "", nil)
+
+	err := b.CreateULICFromOffering("F5-BIG-MSP-BT-1G", "10.0.0.1", "admin", "secret", UnitYearly)
+	assert.Nil(t, err)
+	assert.Contains(t, requests, "POST /mgmt/cm/device/licensing/pool/utility/licenses/REGKEY/offerings/2222/members")
+
+	err = b.DeleteULICFromOffering("F5-BIG-MSP-BT-1G", &ULIC{DeviceAddress: "10.0.0.1", Username: "admin", Password: "secret"})
+	assert.Nil(t, err)
+	assert.Contains(t, requests, "DELETE /mgmt/cm/device/licensing/pool/utility/licenses/REGKEY/offerings/2222/members/m1")
+}